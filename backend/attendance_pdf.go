@@ -18,6 +18,7 @@ import (
 	"sync"
 	"time"
 
+	"cob-aquatics/tasks"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
@@ -31,11 +32,21 @@ const (
 var scriptTagPattern = regexp.MustCompile(`(?is)<script[^>]*>.*?</script>`)
 
 type attendancePDFRequest struct {
-	Template string              `json:"template"`
-	Session  string              `json:"session"`
-	Filename string              `json:"filename"`
-	Roster   attendanceRoster    `json:"roster"`
-	Rosters  []attendancePDFItem `json:"rosters"`
+	// Template names the template of a single roster, used when its level
+	// and service name match no template.
+	Template    string `json:"template"`
+	Session     string `json:"session"`
+	Filename    string `json:"filename"`
+	NameDisplay string `json:"nameDisplay"`
+	// Student details are sensitive and only printed when asked for.
+	ShowAge           bool                `json:"showAge"`
+	ShowGuardian      bool                `json:"showGuardian"`
+	ShowMedicalAlerts bool                `json:"showMedicalAlerts"`
+	Roster            attendanceRoster    `json:"roster"`
+	Rosters           []attendancePDFItem `json:"rosters"`
+	// StrictTemplates rejects rosters whose level matches no template,
+	// rather than printing them on the default template.
+	StrictTemplates bool `json:"strictTemplates"`
 }
 
 type attendancePDFItem struct {
@@ -44,18 +55,25 @@ type attendancePDFItem struct {
 }
 
 type attendanceRoster struct {
-	Code        string              `json:"code"`
-	Level       string              `json:"level"`
-	ServiceName string              `json:"serviceName"`
-	Time        string              `json:"time"`
-	Instructor  string              `json:"instructor"`
-	Location    string              `json:"location"`
-	Schedule    string              `json:"schedule"`
-	Students    []attendanceStudent `json:"students"`
+	Code        string               `json:"code"`
+	Level       string               `json:"level"`
+	ServiceName string               `json:"serviceName"`
+	Time        string               `json:"time"`
+	Instructor  string               `json:"instructor"`
+	Location    string               `json:"location"`
+	Schedule    string               `json:"schedule"`
+	Timing      *tasks.ClassSchedule `json:"timing"`
+	Students    []attendanceStudent  `json:"students"`
 }
 
 type attendanceStudent struct {
-	Name string `json:"name"`
+	Name          string   `json:"name"`
+	FirstName     string   `json:"firstName,omitempty"`
+	LastName      string   `json:"lastName,omitempty"`
+	PreferredName string   `json:"preferredName,omitempty"`
+	Age           *int     `json:"age,omitempty"`
+	Guardian      string   `json:"guardian,omitempty"`
+	MedicalAlerts []string `json:"medicalAlerts,omitempty"`
 }
 
 type attendancePDFPayload struct {
@@ -69,6 +87,7 @@ type attendanceRenderPayload struct {
 	Instructor string              `json:"instructor"`
 	Location   string              `json:"location"`
 	Schedule   string              `json:"schedule"`
+	StartDate  string              `json:"startDate"`
 	Session    string              `json:"session"`
 	Students   []attendanceStudent `json:"students"`
 }
@@ -87,13 +106,22 @@ func attendancePDFHandler(w http.ResponseWriter, r *http.Request) {
 
 	items := req.Rosters
 	if len(items) == 0 {
-		req.Template = strings.TrimSpace(req.Template)
-		if req.Template == "" {
-			http.Error(w, "Missing attendance template", http.StatusBadRequest)
-			return
-		}
 		items = []attendancePDFItem{{Template: req.Template, Roster: req.Roster}}
 	}
+	choices, err := resolveAttendanceItems(items, req.StrictTemplates)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	nameDisplay, ok := tasks.ParseNameDisplay(req.NameDisplay)
+	if !ok {
+		http.Error(w, "Invalid nameDisplay; use first_last or last_first", http.StatusBadRequest)
+		return
+	}
+	for i := range items {
+		items[i].Roster.Students = displayAttendanceStudents(items[i].Roster.Students, nameDisplay, req)
+	}
 
 	pdfs := make([][]byte, 0, len(items))
 	firstTemplate := strings.TrimSpace(items[0].Template)
@@ -112,13 +140,7 @@ func attendancePDFHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		pdfs = rendered
 	} else {
-		template := strings.TrimSpace(items[0].Template)
-		if template == "" {
-			http.Error(w, "Missing attendance template", http.StatusBadRequest)
-			return
-		}
-
-		templatePath, err := resolveAttendanceTemplate(template)
+		templatePath, err := resolveAttendanceTemplate(items[0].Template)
 		if err != nil {
 			http.Error(w, "Attendance template not found", http.StatusNotFound)
 			return
@@ -159,28 +181,25 @@ func attendancePDFHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	writeTemplateChoicesHeader(w, choices)
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
 	w.Write(pdfBytes)
 }
 
+// resolveAttendanceTemplate returns the path of a template named as
+// resolveAttendanceItems leaves it.
 func resolveAttendanceTemplate(template string) (string, error) {
 	templatesDir, err := attendanceTemplatesDir()
 	if err != nil {
 		return "", err
 	}
 
-	templatePath := filepath.Join(templatesDir, fmt.Sprintf("%s.html", template))
-	if _, err := os.Stat(templatePath); err == nil {
-		return templatePath, nil
+	templatePath := filepath.Join(templatesDir, fmt.Sprintf("%s.html", filepath.Base(template)))
+	if _, err := os.Stat(templatePath); err != nil {
+		return "", errTemplateNotFound
 	}
-
-	fallbackPath := filepath.Join(templatesDir, fmt.Sprintf("%s.html", defaultAttendanceLayout))
-	if _, err := os.Stat(fallbackPath); err == nil {
-		return fallbackPath, nil
-	}
-
-	return "", errors.New("attendance template not found")
+	return templatePath, nil
 }
 
 func attendanceTemplatesDir() (string, error) {
@@ -238,6 +257,31 @@ func sanitizeFilename(input string) string {
 	return clean
 }
 
+// displayAttendanceStudents formats names and drops the student details the
+// request did not opt in to, so the template only prints what was asked for.
+func displayAttendanceStudents(students []attendanceStudent, display tasks.NameDisplay, req attendancePDFRequest) []attendanceStudent {
+	output := make([]attendanceStudent, 0, len(students))
+	for _, student := range students {
+		if !req.ShowAge {
+			student.Age = nil
+		}
+		if !req.ShowGuardian {
+			student.Guardian = ""
+		}
+		if !req.ShowMedicalAlerts {
+			student.MedicalAlerts = nil
+		}
+		student.Name = tasks.RosterStudent{
+			Name:          student.Name,
+			FirstName:     student.FirstName,
+			LastName:      student.LastName,
+			PreferredName: student.PreferredName,
+		}.DisplayName(display)
+		output = append(output, student)
+	}
+	return output
+}
+
 func renderAttendancePDF(ctx context.Context, templatePath string, data attendancePDFPayload) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
 	defer cancel()
@@ -279,12 +323,23 @@ func renderAttendancePDFWithContext(ctx context.Context, templatePath string, da
 	}
 	htmlContent := stripScriptTags(string(templateHTML))
 
+	timing := data.Roster.Timing
+	if timing == nil {
+		parsed := tasks.ParseSchedule(data.Roster.Time, "", data.Roster.Schedule)
+		timing = &parsed
+	}
+	startDate := ""
+	if first, ok := timing.FirstMeeting(); ok {
+		startDate = first.Format("01/02/2006")
+	}
+
 	payload := attendanceRenderPayload{
 		Code:       data.Roster.Code,
 		Time:       data.Roster.Time,
 		Instructor: data.Roster.Instructor,
 		Location:   data.Roster.Location,
 		Schedule:   data.Roster.Schedule,
+		StartDate:  startDate,
 		Session:    data.Session,
 		Students:   data.Roster.Students,
 	}
@@ -500,7 +555,7 @@ const fillAttendanceTemplateJS = `(function () {
   }
 
   const schedule = roster.schedule || '';
-  const startDate = schedule.split(' ')[1] || '';
+  const startDate = roster.startDate || schedule.split(' ')[1] || '';
   const startTimeValue = [startDate, roster.time || ''].filter(Boolean).join(' ').trim();
 
   const setText = (id, value) => {
@@ -544,6 +599,22 @@ const fillAttendanceTemplateJS = `(function () {
     strong.textContent = (index + 1) + '. ' + (student.name || '');
     nameCell.appendChild(strong);
 
+    if (student.age !== undefined && student.age !== null) {
+      nameCell.appendChild(document.createTextNode(' (age ' + student.age + ')'));
+    }
+    const details = [];
+    if (student.guardian) {
+      details.push('Guardian: ' + student.guardian);
+    }
+    (student.medicalAlerts || []).forEach(alert => details.push('\u26A0 ' + alert));
+    details.forEach(detail => {
+      const line = document.createElement('div');
+      line.style.fontFamily = 'Arial';
+      line.style.fontSize = '10px';
+      line.textContent = detail;
+      nameCell.appendChild(line);
+    });
+
     const font = document.createElement('font');
 	font.innerHTML = '<br><span style="text-decoration: underline;">A</span>bsent/<span style="text-decoration: underline;">P</span>resent<br><span style="color: rgb(191, 191, 191);font-size: 11px;">[Day 1] [Day 2] [Day 3] [Day 4] [Day 5] [Day 6] [Day 7] [Day 8] [Day 9] [Day 10] [Day 11] [Day 12] [Day 13] [Day 14]</span>';
     nameCell.appendChild(font);
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cob-aquatics/tasks"
+	"github.com/gorilla/mux"
+)
+
+const attendanceTemplateAliasesFile = "attendance-template-aliases.json"
+
+var (
+	errTemplateNotFound = errors.New("attendance template not found")
+	errAliasNotFound    = errors.New("attendance template alias not found")
+)
+
+var attendanceTemplateFiles = &attendanceTemplateCache{}
+
+// attendanceTemplateCache keeps the parsed templates of a directory until a
+// template file is added, removed or modified.
+type attendanceTemplateCache struct {
+	mu        sync.Mutex
+	signature string
+	templates []tasks.AttendanceTemplate
+}
+
+// attendanceTemplates returns every template in the templates directory, in
+// file name order.
+func attendanceTemplates() ([]tasks.AttendanceTemplate, error) {
+	templatesDir, err := attendanceTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	return attendanceTemplateFiles.load(templatesDir)
+}
+
+// load reads and parses the templates in dir again only when the name, size
+// or modification time of one of them has changed since the last load.
+func (c *attendanceTemplateCache) load(dir string) ([]tasks.AttendanceTemplate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []os.FileInfo{}
+	signature := strings.Builder{}
+	signature.WriteString(dir)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".html") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+		fmt.Fprintf(&signature, "\x00%s\x00%d\x00%d", info.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.templates == nil || c.signature != signature.String() {
+		templates := []tasks.AttendanceTemplate{}
+		for _, info := range files {
+			content, err := os.ReadFile(filepath.Join(dir, info.Name()))
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+			templates = append(templates, tasks.ParseAttendanceTemplate(name, string(content), info.ModTime()))
+		}
+		c.signature, c.templates = signature.String(), templates
+	}
+	return append([]tasks.AttendanceTemplate{}, c.templates...), nil
+}
+
+// attendanceTemplate finds a template by name, ignoring case when no name
+// matches exactly.
+func attendanceTemplate(name string) (tasks.AttendanceTemplate, error) {
+	templates, err := attendanceTemplates()
+	if err != nil {
+		return tasks.AttendanceTemplate{}, err
+	}
+	name = strings.TrimSpace(name)
+	for _, template := range templates {
+		if template.Name == name {
+			return template, nil
+		}
+	}
+	for _, template := range templates {
+		if strings.EqualFold(template.Name, name) {
+			return template, nil
+		}
+	}
+	return tasks.AttendanceTemplate{}, errTemplateNotFound
+}
+
+func attendanceTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := attendanceTemplates()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read attendance templates: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": templates,
+	})
+}
+
+func attendanceTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, err := attendanceTemplate(mux.Vars(r)["name"])
+	switch {
+	case errors.Is(err, errTemplateNotFound):
+		http.Error(w, "Attendance template not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Unable to read attendance templates: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// attendanceTemplateChoice is the template used for one roster, reported with
+// the attendance PDF. Requested is the template the request named, when the
+// roster's level chose another.
+type attendanceTemplateChoice struct {
+	Code string `json:"code"`
+	tasks.TemplateMatch
+	Requested string `json:"requested,omitempty"`
+}
+
+// resolveAttendanceItems sets the template of each item from its level or
+// service name, using the saved aliases and then the built-in ones; an item
+// with neither uses its requested template. An item whose level matches no
+// template prints on its requested template, or else the default one, and is
+// flagged as a fallback, unless strict is set, when it fails the request.
+func resolveAttendanceItems(items []attendancePDFItem, strict bool) ([]attendanceTemplateChoice, error) {
+	templates, err := attendanceTemplates()
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, message: fmt.Sprintf("Unable to read attendance templates: %v", err)}
+	}
+	aliases, err := settings.templateAliases()
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, message: fmt.Sprintf("Unable to read template aliases: %v", err)}
+	}
+	resolver := tasks.NewTemplateResolver(templates, append(aliases, tasks.DefaultTemplateAliases...))
+
+	choices := make([]attendanceTemplateChoice, len(items))
+	unknown := []string{}
+	for i := range items {
+		roster := items[i].Roster
+		requested := strings.TrimSpace(items[i].Template)
+		level := firstNonEmpty(roster.Level, roster.ServiceName)
+		match, ok := resolver.Resolve(roster.Level, roster.ServiceName)
+		if !ok && level == "" {
+			match, ok = resolver.Resolve(requested)
+		}
+		if !ok {
+			label := strings.TrimSpace(roster.Code)
+			if label == "" {
+				label = fmt.Sprintf("%d", i+1)
+			}
+			unknown = append(unknown, fmt.Sprintf("%s (%q)", label, firstNonEmpty(level, requested)))
+			match = tasks.TemplateMatch{Template: defaultAttendanceLayout, Rule: tasks.TemplateMatchFallback, Fallback: true}
+			if guess, found := resolver.Resolve(requested); found && level != "" {
+				match.Template, match.Source = guess.Template, guess.Source
+			}
+		}
+		items[i].Template = match.Template
+		choices[i] = attendanceTemplateChoice{Code: roster.Code, TemplateMatch: match}
+		if requested != "" && !strings.EqualFold(requested, match.Template) {
+			choices[i].Requested = requested
+		}
+	}
+	if strict && len(unknown) > 0 {
+		return nil, &uploadError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("No attendance template matches roster %s; add a template alias for its level", strings.Join(unknown, ", ")),
+		}
+	}
+	return choices, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// writeTemplateChoicesHeader reports the template of each roster alongside
+// the PDF, and X-Attendance-Template-Fallbacks counts the rosters printed on
+// the default template.
+func writeTemplateChoicesHeader(w http.ResponseWriter, choices []attendanceTemplateChoice) {
+	fallbacks := 0
+	for _, choice := range choices {
+		if choice.Fallback {
+			fallbacks++
+		}
+	}
+	w.Header().Set("X-Attendance-Template-Fallbacks", fmt.Sprintf("%d", fallbacks))
+	writeListHeader(w, "X-Attendance-Templates", len(choices), func(count int) ([]byte, error) {
+		return json.Marshal(choices[:count])
+	})
+}
+
+// resolveAttendanceTemplatesHandler previews the templates an attendance
+// request would use, without printing it.
+func resolveAttendanceTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	var req attendancePDFRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	items := req.Rosters
+	if len(items) == 0 {
+		items = []attendancePDFItem{{Template: req.Template, Roster: req.Roster}}
+	}
+	choices, err := resolveAttendanceItems(items, req.StrictTemplates)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": choices,
+	})
+}
+
+// templateAliases returns the saved template aliases sorted by alias.
+func (s *settingsStore) templateAliases() ([]tasks.TemplateAlias, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readTemplateAliases()
+}
+
+func (s *settingsStore) readTemplateAliases() ([]tasks.TemplateAlias, error) {
+	aliases := []tasks.TemplateAlias{}
+	if err := s.read(attendanceTemplateAliasesFile, &aliases); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return strings.ToLower(aliases[i].Alias) < strings.ToLower(aliases[j].Alias)
+	})
+	return aliases, nil
+}
+
+// saveTemplateAlias adds an alias or replaces the one with the same text.
+func (s *settingsStore) saveTemplateAlias(alias tasks.TemplateAlias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases, err := s.readTemplateAliases()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range aliases {
+		if strings.EqualFold(aliases[i].Alias, alias.Alias) {
+			aliases[i] = alias
+			replaced = true
+		}
+	}
+	if !replaced {
+		aliases = append(aliases, alias)
+	}
+	return s.write(attendanceTemplateAliasesFile, aliases)
+}
+
+func (s *settingsStore) deleteTemplateAlias(alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases, err := s.readTemplateAliases()
+	if err != nil {
+		return err
+	}
+	kept := aliases[:0]
+	for _, saved := range aliases {
+		if !strings.EqualFold(saved.Alias, strings.TrimSpace(alias)) {
+			kept = append(kept, saved)
+		}
+	}
+	if len(kept) == len(aliases) {
+		return errAliasNotFound
+	}
+	return s.write(attendanceTemplateAliasesFile, kept)
+}
+
+func attendanceTemplateAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	aliases, err := settings.templateAliases()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read template aliases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"aliases":  aliases,
+		"defaults": tasks.DefaultTemplateAliases,
+	})
+}
+
+func saveAttendanceTemplateAliasHandler(w http.ResponseWriter, r *http.Request) {
+	var alias tasks.TemplateAlias
+	if err := json.NewDecoder(r.Body).Decode(&alias); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	alias.Alias = strings.TrimSpace(alias.Alias)
+	if alias.Alias == "" {
+		http.Error(w, "Missing alias", http.StatusBadRequest)
+		return
+	}
+	template, err := attendanceTemplate(alias.Template)
+	switch {
+	case errors.Is(err, errTemplateNotFound):
+		http.Error(w, fmt.Sprintf("Unknown attendance template %q", alias.Template), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Unable to read attendance templates: %v", err), http.StatusInternalServerError)
+		return
+	}
+	alias.Template = template.Name
+
+	if err := settings.saveTemplateAlias(alias); err != nil {
+		http.Error(w, fmt.Sprintf("Unable to save template alias: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alias)
+}
+
+func deleteAttendanceTemplateAliasHandler(w http.ResponseWriter, r *http.Request) {
+	err := settings.deleteTemplateAlias(mux.Vars(r)["alias"])
+	switch {
+	case errors.Is(err, errAliasNotFound):
+		http.Error(w, "Template alias not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Unable to delete template alias: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -7,8 +7,10 @@ require (
 	github.com/chromedp/chromedp v0.10.1
 	github.com/gorilla/mux v1.8.0
 	github.com/pdfcpu/pdfcpu v0.8.1
+	github.com/richardlehane/mscfb v1.0.4
 	github.com/rs/cors v1.10.1
 	github.com/xuri/excelize/v2 v2.8.1
+	golang.org/x/text v0.17.0
 )
 
 require (
@@ -23,7 +25,6 @@ require (
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.3 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/xuri/efp v0.0.0-20231025114914-d1ff6096ae53 // indirect
@@ -32,6 +33,5 @@ require (
 	golang.org/x/image v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/text v0.17.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
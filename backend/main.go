@@ -1,11 +1,14 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"cob-aquatics/tasks"
@@ -14,13 +17,33 @@ import (
 )
 
 func main() {
+	if path := strings.TrimSpace(os.Getenv("IMPORT_PROFILES_PATH")); path != "" {
+		if err := tasks.LoadImportProfiles(path); err != nil {
+			log.Fatalf("unable to load import profiles: %v", err)
+		}
+	}
+
 	r := mux.NewRouter()
 
 	// API routes
 	r.HandleFunc("/api/process-csv", processCSVHandler).Methods("POST")
+	r.HandleFunc("/api/import-profiles", importProfilesHandler).Methods("GET")
+	r.HandleFunc("/api/roster-diff", rosterDiffHandler).Methods("POST")
 	r.HandleFunc("/api/masterlist", masterListHandler).Methods("POST")
 	r.HandleFunc("/api/masterlist-rosters", masterListRostersHandler).Methods("POST")
+	r.HandleFunc("/api/masterlist-import", masterListImportHandler).Methods("POST")
+	r.HandleFunc("/api/masterlist-presets", masterListPresetsHandler).Methods("GET")
+	r.HandleFunc("/api/masterlist-presets", saveMasterListPresetHandler).Methods("POST")
+	r.HandleFunc("/api/masterlist-presets/{name}", deleteMasterListPresetHandler).Methods("DELETE")
+	r.HandleFunc("/api/masterlist-page-setup", masterListPageSetupHandler).Methods("GET")
+	r.HandleFunc("/api/masterlist-page-setup", saveMasterListPageSetupHandler).Methods("POST")
 	r.HandleFunc("/api/attendance-pdf", attendancePDFHandler).Methods("POST")
+	r.HandleFunc("/api/attendance-templates", attendanceTemplatesHandler).Methods("GET")
+	r.HandleFunc("/api/attendance-templates/resolve", resolveAttendanceTemplatesHandler).Methods("POST")
+	r.HandleFunc("/api/attendance-templates/{name}", attendanceTemplateHandler).Methods("GET")
+	r.HandleFunc("/api/attendance-template-aliases", attendanceTemplateAliasesHandler).Methods("GET")
+	r.HandleFunc("/api/attendance-template-aliases", saveAttendanceTemplateAliasHandler).Methods("POST")
+	r.HandleFunc("/api/attendance-template-aliases/{alias}", deleteAttendanceTemplateAliasHandler).Methods("DELETE")
 	r.HandleFunc("/api/concat-pdfs", concatPDFHandler).Methods("POST")
 	r.HandleFunc("/api/health", healthHandler).Methods("GET")
 
@@ -29,8 +52,9 @@ func main() {
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"},
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"Content-Disposition", "X-Instructor-Conflicts", "X-Instructor-Conflicts-Total", "X-PDF-Renderer", "X-Attendance-Templates", "X-Attendance-Templates-Total", "X-Attendance-Template-Fallbacks"},
 	})
 
 	handler := c.Handler(r)
@@ -47,120 +71,229 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+func importProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": tasks.ImportProfiles(),
+	})
+}
+
 func processCSVHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("backend called for process csv")
-	file, _, err := r.FormFile("csv_file")
-	if err != nil {
-		http.Error(w, "No file uploaded", http.StatusBadRequest)
+	if err := parseUploadForm(w, r); err != nil {
+		writeUploadError(w, err)
 		return
 	}
-	defer file.Close()
 
 	day := r.FormValue("day")
+	instructors := parseInstructorAssignment(r)
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	result, err := processUploadField(r, "csv_file", r.FormValue("profile"), day, instructors)
 	if err != nil {
-		http.Error(w, "Error reading CSV", http.StatusInternalServerError)
-		return
-	}
-
-	instructorMap := map[string]string{}
-	if err := r.ParseMultipartForm(32 << 20); err == nil && r.MultipartForm != nil {
-		names := r.MultipartForm.Value["instructor_names[]"]
-		codes := r.MultipartForm.Value["instructor_codes[]"]
-		for i, name := range names {
-			if strings.TrimSpace(name) == "" {
-				continue
-			}
-			codeList := ""
-			if i < len(codes) {
-				codeList = codes[i]
-			}
-			for _, code := range strings.Split(codeList, ",") {
-				trimmed := strings.TrimSpace(code)
-				if trimmed == "" {
-					continue
-				}
-				instructorMap[trimmed] = strings.TrimSpace(name)
-			}
+		var uploadErr *uploadError
+		if !errors.As(err, &uploadErr) || uploadErr.status != http.StatusUnprocessableEntity {
+			writeUploadError(w, err)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     false,
+			"error":       err.Error(),
+			"profile":     result.Profile.Name,
+			"diagnostics": result.Diagnostics,
+			"summary":     tasks.SummarizeDiagnostics(result.Diagnostics),
+			"conflicts":   result.Conflicts,
+		})
+		return
 	}
+	profile := result.Profile
 
-	classes, total, err := tasks.ProcessCSV(records, instructorMap, day)
+	uploadID, err := uploads.save(storedUpload{
+		Day:     day,
+		Profile: profile.Name,
+		Classes: result.Classes,
+	})
 	if err != nil {
-		http.Error(w, "Error processing CSV", http.StatusInternalServerError)
-		return
+		log.Printf("process csv: unable to store upload: %v", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"day":     day,
-		"total":   total,
-		"classes": classes,
+		"success":     true,
+		"day":         day,
+		"profile":     profile.Name,
+		"uploadId":    uploadID,
+		"total":       result.Total,
+		"classes":     result.Classes,
+		"byDay":       tasks.ClassCodesByDay(result.Classes),
+		"diagnostics": result.Diagnostics,
+		"summary":     tasks.SummarizeDiagnostics(result.Diagnostics),
+		"conflicts":   result.Conflicts,
 	})
 }
 
+func parseInstructorAssignment(r *http.Request) tasks.InstructorAssignment {
+	if err := r.ParseMultipartForm(multipartMemoryBytes); err != nil || r.MultipartForm == nil {
+		return tasks.InstructorAssignment{}
+	}
+	return tasks.ParseInstructorAssignment(
+		r.MultipartForm.Value["instructor_names[]"],
+		r.MultipartForm.Value["instructor_codes[]"],
+	)
+}
+
+// maxConflictsHeaderBytes keeps list headers, such as the conflicts header,
+// well inside the header size limits of browsers and HTTP clients.
+const maxConflictsHeaderBytes = 8 << 10
+
+// writeConflictsHeader reports instructor conflicts alongside binary
+// downloads, where they cannot go in a JSON body.
+func writeConflictsHeader(w http.ResponseWriter, conflicts []tasks.InstructorConflict) {
+	writeListHeader(w, "X-Instructor-Conflicts", len(conflicts), func(count int) ([]byte, error) {
+		return json.Marshal(conflicts[:count])
+	})
+}
+
+// writeListHeader sets header to a JSON list of count items, encoded by
+// encode, then percent-encoded so that names outside ASCII survive the header;
+// clients read it with decodeURIComponent. When the list is too long for a
+// header only the first items are sent, and header-Total gives the full count.
+func writeListHeader(w http.ResponseWriter, header string, total int, encode func(count int) ([]byte, error)) {
+	if total == 0 {
+		return
+	}
+	for count := total; count > 0; count /= 2 {
+		encoded, err := encode(count)
+		if err != nil {
+			return
+		}
+		if value := url.PathEscape(string(encoded)); len(value) <= maxConflictsHeaderBytes {
+			w.Header().Set(header, value)
+			if count < total {
+				w.Header().Set(header+"-Total", strconv.Itoa(total))
+			}
+			return
+		}
+	}
+}
+
+// masterListHandler serves a masterlist in the format chosen by format
+// (xlsx, pdf, csv or html; default xlsx). Rosters come from an uploaded
+// export in csv_file, or from a JSON body like /api/masterlist-rosters.
 func masterListHandler(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		serveMasterListRosters(w, r, tasks.MasterListXLSX)
+		return
+	}
+	if err := parseUploadForm(w, r); err != nil {
+		writeUploadError(w, err)
 		return
 	}
 
-	file, _, err := r.FormFile("csv_file")
+	format, ok := tasks.ParseMasterListFormat(r.FormValue("format"), tasks.MasterListXLSX)
+	if !ok {
+		http.Error(w, invalidMasterListFormat, http.StatusBadRequest)
+		return
+	}
+	options, err := formMasterListOptions(r)
 	if err != nil {
-		http.Error(w, "No file uploaded", http.StatusBadRequest)
+		writeUploadError(w, err)
 		return
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	records, err := readUploadRecords(r)
 	if err != nil {
-		http.Error(w, "Error reading CSV", http.StatusBadRequest)
+		writeUploadError(w, err)
 		return
 	}
 
-	options := tasks.FormatOptions{
-		TimeHeaders:       r.FormValue("time_headers") != "",
-		InstructorHeaders: r.FormValue("instructor_headers") != "",
-		CourseHeaders:     r.FormValue("course_headers") != "",
-		Borders:           r.FormValue("borders") != "",
-		CenterTime:        r.FormValue("center_time") != "",
-		BoldTime:          r.FormValue("bold_time") != "",
-		CenterCourse:      r.FormValue("center_course") != "",
-		BoldCourse:        r.FormValue("bold_course") != "",
-	}
-
-	nameList := r.MultipartForm.Value["instructor_names[]"]
-	codeList := r.MultipartForm.Value["instructor_codes[]"]
-	instructorMap := map[string]string{}
-
-	for i, name := range nameList {
-		if strings.TrimSpace(name) == "" {
-			continue
-		}
-		codes := ""
-		if i < len(codeList) {
-			codes = codeList[i]
-		}
-		for _, code := range strings.Split(codes, ",") {
-			trimmed := strings.TrimSpace(code)
-			if trimmed == "" {
-				continue
-			}
-			instructorMap[trimmed] = strings.TrimSpace(name)
-		}
+	classes, options, err := tasks.MasterListClasses(records, options, parseInstructorAssignment(r))
+	if err != nil {
+		writeUploadError(w, classifyRowsError(err))
+		return
 	}
 
-	result, err := tasks.ProcessMasterList(records, options, instructorMap)
+	writeMasterList(w, r, format, classes.Classes, options, classes.Conflicts)
+}
+
+func formMasterListOptions(r *http.Request) (tasks.FormatOptions, error) {
+	nameDisplay, err := formNameDisplay(r)
 	if err != nil {
-		http.Error(w, "Error processing CSV", http.StatusInternalServerError)
-		return
+		return tasks.FormatOptions{}, err
+	}
+	sessionStart, err := formSessionStart(r)
+	if err != nil {
+		return tasks.FormatOptions{}, err
+	}
+	sortOrder, err := formSortOrder(r)
+	if err != nil {
+		return tasks.FormatOptions{}, err
+	}
+	layout, ok := tasks.ParseWorkbookLayout(r.FormValue("layout"))
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid layout; use single, multi or instructor"}
+	}
+	columns, err := formColumns(r)
+	if err != nil {
+		return tasks.FormatOptions{}, err
+	}
+	orientation, ok := tasks.ParsePageOrientation(r.FormValue("orientation"))
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid orientation; use portrait or landscape"}
+	}
+	pageBreaks, ok := tasks.ParsePageBreaks(r.FormValue("page_breaks"))
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid page_breaks; use none, time or instructor"}
+	}
+	pdfPage, err := formPDFPageSetup(r)
+	if err != nil {
+		return tasks.FormatOptions{}, err
+	}
+	pdfRenderer, ok := tasks.ParsePDFRenderer(r.FormValue("pdf_renderer"))
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: invalidPDFRenderer}
 	}
 
-	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", result.Filename))
-	w.Write(result.Data)
+	options := tasks.FormatOptions{
+		TimeHeaders:         r.FormValue("time_headers") != "",
+		InstructorHeaders:   r.FormValue("instructor_headers") != "",
+		CourseHeaders:       r.FormValue("course_headers") != "",
+		Borders:             r.FormValue("borders") != "",
+		CenterTime:          r.FormValue("center_time") != "",
+		BoldTime:            r.FormValue("bold_time") != "",
+		CenterCourse:        r.FormValue("center_course") != "",
+		BoldCourse:          r.FormValue("bold_course") != "",
+		NameDisplay:         nameDisplay,
+		ShowAge:             r.FormValue("show_age") != "",
+		ShowGuardian:        r.FormValue("show_guardian") != "",
+		ShowMedicalAlerts:   r.FormValue("show_medical") != "",
+		SessionStart:        sessionStart,
+		FallbackDay:         r.FormValue("day"),
+		SortOrder:           sortOrder,
+		Layout:              layout,
+		Columns:             columns,
+		FreezeHeader:        r.FormValue("freeze_header") != "",
+		AutoFilter:          r.FormValue("autofilter") != "",
+		Orientation:         orientation,
+		FitToWidth:          r.FormValue("fit_width") != "",
+		RepeatHeader:        r.FormValue("repeat_header") != "",
+		PageBreaks:          pageBreaks,
+		HeaderFooter:        r.FormValue("header_footer") != "",
+		SessionName:         r.FormValue("session_name"),
+		PDFPage:             pdfPage,
+		PDFRenderer:         pdfRenderer,
+		KeepClassTogether:   r.FormValue("keep_together") != "",
+		ContinuedHeaders:    r.FormValue("continued_headers") != "",
+		ShowCapacity:        r.FormValue("show_capacity") != "",
+		HighlightEnrollment: r.FormValue("highlight_enrollment") != "",
+		ClassTotals:         r.FormValue("class_totals") != "",
+		TimeTotals:          r.FormValue("time_totals") != "",
+		LevelTotals:         r.FormValue("level_totals") != "",
+		InstructorTotals:    r.FormValue("instructor_totals") != "",
+		GrandTotal:          r.FormValue("grand_total") != "",
+		ShowClassCount:      r.FormValue("show_class_count") != "",
+	}
+	_, headerFooterSet := r.Form["header_footer"]
+	return applyPageDefaults(options, headerFooterSet)
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cob-aquatics/tasks"
+)
+
+// masterListImportHandler reads an edited masterlist workbook (masterlist_file)
+// back into rosters and compares them with the current rosters: a JSON array
+// in rosters, or otherwise a stored upload (upload, default "latest").
+func masterListImportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := parseUploadForm(w, r); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	file, _, err := r.FormFile("masterlist_file")
+	if err != nil {
+		http.Error(w, "No file uploaded in masterlist_file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	imported, err := tasks.ImportMasterList(file)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, tasks.ErrNoStudents) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, fmt.Sprintf("Error reading masterlist: %v", err), status)
+		return
+	}
+
+	day := r.FormValue("day")
+	var current []tasks.ClassRoster
+	currentLabel := "submitted rosters"
+	if value := strings.TrimSpace(r.FormValue("rosters")); value != "" {
+		if err := json.Unmarshal([]byte(value), &current); err != nil {
+			http.Error(w, "Invalid rosters", http.StatusBadRequest)
+			return
+		}
+	} else {
+		id := strings.TrimSpace(r.FormValue("upload"))
+		if id == "" {
+			id = "latest"
+		}
+		stored, err := uploads.load(id, day)
+		if err != nil {
+			if errors.Is(err, errUploadNotFound) {
+				http.Error(w, "Upload to compare with not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Unable to load upload: %v", err), http.StatusInternalServerError)
+			return
+		}
+		current = stored.Classes
+		currentLabel = fmt.Sprintf("upload of %s", stored.CreatedAt.Format("Jan 2, 2006 3:04 PM"))
+	}
+
+	tasks.ReconcileMasterList(imported.Classes, current)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"day":         day,
+		"compared":    currentLabel,
+		"sheets":      imported.Sheets,
+		"classes":     imported.Classes,
+		"diagnostics": imported.Diagnostics,
+		"summary":     tasks.SummarizeDiagnostics(imported.Diagnostics),
+		"diff":        tasks.DiffRosters(current, imported.Classes),
+	})
+}
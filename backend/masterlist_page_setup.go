@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cob-aquatics/tasks"
+)
+
+const masterListPageSetupFile = "masterlist-page-setup.json"
+
+// masterListPageDefaults is the saved page setup for masterlists, used for
+// every value a request leaves unset.
+type masterListPageDefaults struct {
+	tasks.PDFPageSetup
+	Orientation  tasks.PageOrientation `json:"orientation,omitempty"`
+	HeaderFooter bool                  `json:"header_footer"`
+	SessionName  string                `json:"session_name,omitempty"`
+	PDFRenderer  tasks.PDFRenderer     `json:"pdf_renderer,omitempty"`
+}
+
+func (s *settingsStore) pageDefaults() (masterListPageDefaults, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var defaults masterListPageDefaults
+	err := s.read(masterListPageSetupFile, &defaults)
+	return defaults, err
+}
+
+func (s *settingsStore) savePageDefaults(defaults masterListPageDefaults) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(masterListPageSetupFile, defaults)
+}
+
+func masterListPageSetupHandler(w http.ResponseWriter, r *http.Request) {
+	defaults, err := settings.pageDefaults()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read page setup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"defaults":  defaults,
+		"effective": defaults.PDFPageSetup.WithDefaults(tasks.PDFPageSetup{}),
+	})
+}
+
+func saveMasterListPageSetupHandler(w http.ResponseWriter, r *http.Request) {
+	var defaults masterListPageDefaults
+	if err := json.NewDecoder(r.Body).Decode(&defaults); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := defaults.PDFPageSetup.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orientation, ok := tasks.ParsePageOrientation(string(defaults.Orientation))
+	if !ok {
+		http.Error(w, "Invalid orientation; use portrait or landscape", http.StatusBadRequest)
+		return
+	}
+	renderer, ok := tasks.ParsePDFRenderer(string(defaults.PDFRenderer))
+	if !ok {
+		http.Error(w, invalidPDFRenderer, http.StatusBadRequest)
+		return
+	}
+	defaults.Orientation = orientation
+	defaults.PDFRenderer = renderer
+	defaults.PaperSize, _ = tasks.ParsePaperSize(string(defaults.PaperSize))
+	defaults.SessionName = strings.TrimSpace(defaults.SessionName)
+
+	if err := settings.savePageDefaults(defaults); err != nil {
+		http.Error(w, fmt.Sprintf("Unable to save page setup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(defaults)
+}
+
+// applyPageDefaults fills the page setup a request left unset from the saved
+// defaults. headerFooterSet reports whether the request chose header_footer.
+func applyPageDefaults(options tasks.FormatOptions, headerFooterSet bool) (tasks.FormatOptions, error) {
+	defaults, err := settings.pageDefaults()
+	if err != nil {
+		return options, &uploadError{status: http.StatusInternalServerError, message: fmt.Sprintf("Unable to read page setup: %v", err)}
+	}
+	options.PDFPage = options.PDFPage.WithDefaults(defaults.PDFPageSetup)
+	if options.Orientation == tasks.OrientationDefault {
+		options.Orientation = defaults.Orientation
+	}
+	if !headerFooterSet {
+		options.HeaderFooter = defaults.HeaderFooter
+	}
+	if strings.TrimSpace(options.SessionName) == "" {
+		options.SessionName = defaults.SessionName
+	}
+	if options.PDFRenderer == tasks.PDFRendererAuto {
+		options.PDFRenderer = defaults.PDFRenderer
+	}
+	return options, nil
+}
+
+const invalidPDFRenderer = "Invalid pdf_renderer; use auto, chrome or native"
+
+// formPDFPageSetup reads paper_size, margin (inches), font_size and scale.
+func formPDFPageSetup(r *http.Request) (tasks.PDFPageSetup, error) {
+	paperSize, ok := tasks.ParsePaperSize(r.FormValue("paper_size"))
+	if !ok {
+		return tasks.PDFPageSetup{}, &uploadError{status: http.StatusBadRequest, message: "Invalid paper_size; use letter, legal, tabloid, a4 or a3"}
+	}
+	setup := tasks.PDFPageSetup{PaperSize: paperSize}
+	fields := []struct {
+		name string
+		set  func(value float64)
+	}{
+		{"margin", func(value float64) { setup.Margin = &value }},
+		{"font_size", func(value float64) { setup.FontSize = value }},
+		{"scale", func(value float64) { setup.Scale = value }},
+	}
+	for _, field := range fields {
+		value := strings.TrimSpace(r.FormValue(field.name))
+		if value == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return tasks.PDFPageSetup{}, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Invalid %s", field.name)}
+		}
+		field.set(number)
+	}
+	if err := setup.Validate(); err != nil {
+		return tasks.PDFPageSetup{}, &uploadError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	return setup, nil
+}
+
+// masterListPrintOptions builds the running header, with the session name,
+// days and time of printing, and the "Page X of Y" footer.
+func masterListPrintOptions(options tasks.FormatOptions, days string) pdfPrintOptions {
+	page := options.PDFPage.WithDefaults(tasks.PDFPageSetup{})
+	printOptions := pdfPrintOptions{scale: page.Scale}
+	if !options.HeaderFooter {
+		return printOptions
+	}
+
+	margin, _ := page.Margins(false)
+	style := fmt.Sprintf("width:100%%;margin:0 %.2fin;font-family:Arial,sans-serif;font-size:8px;color:#333;", margin)
+	printOptions.headerTemplate = fmt.Sprintf(
+		`<div style="%sdisplay:flex;justify-content:space-between;"><span style="font-weight:700;">%s</span><span>%s</span><span>Generated %s</span></div>`,
+		style,
+		html.EscapeString(strings.TrimSpace(options.SessionName)),
+		html.EscapeString(days),
+		html.EscapeString(time.Now().Format("Jan 2, 2006 3:04 PM")),
+	)
+	printOptions.footerTemplate = fmt.Sprintf(
+		`<div style="%stext-align:center;">Page <span class="pageNumber"></span> of <span class="totalPages"></span></div>`,
+		style,
+	)
+	return printOptions
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cob-aquatics/tasks"
+	"github.com/gorilla/mux"
+)
+
+func masterListPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	presets, err := settings.presets()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read presets: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"columns": tasks.MasterListColumns(),
+		"presets": presets,
+	})
+}
+
+func saveMasterListPresetHandler(w http.ResponseWriter, r *http.Request) {
+	var preset tasks.ColumnPreset
+	if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		http.Error(w, "Missing preset name", http.StatusBadRequest)
+		return
+	}
+	if len(preset.Columns) == 0 {
+		http.Error(w, "Missing columns", http.StatusBadRequest)
+		return
+	}
+	columns, err := tasks.ResolveColumns(preset.Columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	preset.Columns = columns
+
+	if err := settings.savePreset(preset); err != nil {
+		http.Error(w, fmt.Sprintf("Unable to save preset: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preset)
+}
+
+func deleteMasterListPresetHandler(w http.ResponseWriter, r *http.Request) {
+	err := settings.deletePreset(mux.Vars(r)["name"])
+	switch {
+	case errors.Is(err, errPresetNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Unable to delete preset: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveColumnChoice picks the masterlist columns for a request: explicit
+// columns win over a named preset, and neither means the default layout.
+func resolveColumnChoice(columns []tasks.ColumnSpec, presetName string) ([]tasks.ColumnSpec, error) {
+	if len(columns) > 0 {
+		resolved, err := tasks.ResolveColumns(columns)
+		if err != nil {
+			return nil, &uploadError{status: http.StatusBadRequest, message: err.Error()}
+		}
+		return resolved, nil
+	}
+	if strings.TrimSpace(presetName) == "" {
+		return nil, nil
+	}
+	preset, err := settings.preset(presetName)
+	if errors.Is(err, errPresetNotFound) {
+		return nil, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Unknown preset %q", presetName)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tasks.ResolveColumns(preset.Columns)
+}
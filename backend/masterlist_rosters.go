@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"html"
+	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -20,34 +21,67 @@ import (
 type masterListRostersRequest struct {
 	Rosters []tasks.ClassRoster     `json:"rosters"`
 	Options masterListRosterOptions `json:"options"`
+	Format  string                  `json:"format"`
 }
 
 type masterListRosterOptions struct {
-	TimeHeaders       bool `json:"time_headers"`
-	InstructorHeaders bool `json:"instructor_headers"`
-	CourseHeaders     bool `json:"course_headers"`
-	Borders           bool `json:"borders"`
-	CenterTime        bool `json:"center_time"`
-	BoldTime          bool `json:"bold_time"`
-	CenterCourse      bool `json:"center_course"`
-	BoldCourse        bool `json:"bold_course"`
+	TimeHeaders       bool   `json:"time_headers"`
+	InstructorHeaders bool   `json:"instructor_headers"`
+	CourseHeaders     bool   `json:"course_headers"`
+	Borders           bool   `json:"borders"`
+	CenterTime        bool   `json:"center_time"`
+	BoldTime          bool   `json:"bold_time"`
+	CenterCourse      bool   `json:"center_course"`
+	BoldCourse        bool   `json:"bold_course"`
+	NameDisplay       string `json:"name_display"`
+	ShowAge           bool   `json:"show_age"`
+	ShowGuardian      bool   `json:"show_guardian"`
+	ShowMedicalAlerts bool   `json:"show_medical"`
+	SortOrder         string `json:"sort"`
+	ShowCapacity      bool   `json:"show_capacity"`
+	// HighlightEnrollment fills the course headers of under-enrolled classes.
+	HighlightEnrollment bool `json:"highlight_enrollment"`
+	// Columns, or failing that the saved Preset, replace the default columns.
+	Columns []tasks.ColumnSpec `json:"columns"`
+	Preset  string             `json:"preset"`
+
+	// Workbook layout and print setup, used by the xlsx format.
+	Layout       string `json:"layout"`
+	FreezeHeader bool   `json:"freeze_header"`
+	AutoFilter   bool   `json:"autofilter"`
+	Orientation  string `json:"orientation"`
+	FitToWidth   bool   `json:"fit_width"`
+	RepeatHeader bool   `json:"repeat_header"`
+	PageBreaks   string `json:"page_breaks"`
+	HeaderFooter *bool  `json:"header_footer"`
+	SessionName  string `json:"session_name"`
+	// PDF page setup; unset values use the saved defaults.
+	PaperSize string   `json:"paper_size"`
+	Margin    *float64 `json:"margin"`
+	FontSize  float64  `json:"font_size"`
+	Scale     float64  `json:"scale"`
+	// PDFRenderer is auto, chrome or native.
+	PDFRenderer string `json:"pdf_renderer"`
+	// PDF pagination; page_breaks also applies.
+	KeepTogether     bool `json:"keep_together"`
+	ContinuedHeaders bool `json:"continued_headers"`
+
+	// Total rows, and the number of students on course headers.
+	ClassTotals      bool `json:"class_totals"`
+	TimeTotals       bool `json:"time_totals"`
+	LevelTotals      bool `json:"level_totals"`
+	InstructorTotals bool `json:"instructor_totals"`
+	GrandTotal       bool `json:"grand_total"`
+	ShowClassCount   bool `json:"show_class_count"`
 }
 
-type masterListRowKind int
-
-const (
-	masterListRowData masterListRowKind = iota
-	masterListRowTimeHeader
-	masterListRowCourseHeader
-)
-
-type masterListRow struct {
-	kind  masterListRowKind
-	label string
-	cells []string
+// masterListRostersHandler serves the masterlist of rosters posted as JSON.
+// It is kept for older clients and defaults to a PDF.
+func masterListRostersHandler(w http.ResponseWriter, r *http.Request) {
+	serveMasterListRosters(w, r, tasks.MasterListPDF)
 }
 
-func masterListRostersHandler(w http.ResponseWriter, r *http.Request) {
+func serveMasterListRosters(w http.ResponseWriter, r *http.Request, defaultFormat tasks.MasterListFormat) {
 	var req masterListRostersRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -59,258 +93,358 @@ func masterListRostersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := buildMasterListRows(req.Rosters, req.Options)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error building master list: %v", err), http.StatusBadRequest)
+	formatValue := req.Format
+	if formatValue == "" {
+		formatValue = r.URL.Query().Get("format")
+	}
+	format, ok := tasks.ParseMasterListFormat(formatValue, defaultFormat)
+	if !ok {
+		http.Error(w, invalidMasterListFormat, http.StatusBadRequest)
 		return
 	}
 
-	htmlContent := buildMasterListHTML(rows, req.Options)
-	pdfBytes, err := renderMasterListPDF(r.Context(), htmlContent)
+	options, err := req.Options.formatOptions()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to render master list PDF: %v", err), http.StatusInternalServerError)
+		writeUploadError(w, err)
 		return
 	}
 
-	filename := buildMasterListPdfFilename()
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
-	w.Write(pdfBytes)
+	writeMasterList(w, r, format, req.Rosters, options, tasks.InstructorTimeConflicts(req.Rosters))
 }
 
-func buildMasterListRows(
-	rosters []tasks.ClassRoster,
-	options masterListRosterOptions,
-) ([]masterListRow, error) {
-	rows := make([]masterListRow, 0)
-	currentTime := ""
-	dataCount := 0
-
-	for _, roster := range rosters {
-		timeValue := strings.TrimSpace(roster.Time)
-		if options.TimeHeaders && timeValue != "" && timeValue != currentTime {
-			rows = append(rows, masterListRow{
-				kind:  masterListRowTimeHeader,
-				label: timeValue,
-			})
-			currentTime = timeValue
-		}
-
-		if options.CourseHeaders {
-			label := strings.TrimSpace(roster.ServiceName)
-			if label == "" {
-				label = strings.TrimSpace(roster.Code)
-			}
-
-			if options.InstructorHeaders {
-				instructor := strings.TrimSpace(roster.Instructor)
-				if instructor == "" && len(roster.Students) > 0 {
-					instructor = strings.TrimSpace(roster.Students[0].Instructor)
-				}
-				if instructor != "" {
-					label = fmt.Sprintf("%s - %s", label, instructor)
-				}
-			}
-
-			if label != "" {
-				rows = append(rows, masterListRow{
-					kind:  masterListRowCourseHeader,
-					label: label,
-				})
-			}
-		}
-
-		for _, student := range roster.Students {
-			name := strings.TrimSpace(student.Name)
-			if name == "" {
-				continue
-			}
+// formatOptions checks the options and converts them for the tasks package.
+func (o masterListRosterOptions) formatOptions() (tasks.FormatOptions, error) {
+	nameDisplay, ok := tasks.ParseNameDisplay(o.NameDisplay)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid name_display; use first_last or last_first"}
+	}
+	sortOrder, ok := tasks.ParseSortOrder(o.SortOrder)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid sort; use time, instructor, location, level or code"}
+	}
+	layout, ok := tasks.ParseWorkbookLayout(o.Layout)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid layout; use single, multi or instructor"}
+	}
+	orientation, ok := tasks.ParsePageOrientation(o.Orientation)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid orientation; use portrait or landscape"}
+	}
+	pageBreaks, ok := tasks.ParsePageBreaks(o.PageBreaks)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid page_breaks; use none, time or instructor"}
+	}
+	paperSize, ok := tasks.ParsePaperSize(o.PaperSize)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: "Invalid paper_size; use letter, legal, tabloid, a4 or a3"}
+	}
+	pdfRenderer, ok := tasks.ParsePDFRenderer(o.PDFRenderer)
+	if !ok {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: invalidPDFRenderer}
+	}
+	pdfPage := tasks.PDFPageSetup{PaperSize: paperSize, Margin: o.Margin, FontSize: o.FontSize, Scale: o.Scale}
+	if err := pdfPage.Validate(); err != nil {
+		return tasks.FormatOptions{}, &uploadError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	columns, err := resolveColumnChoice(o.Columns, o.Preset)
+	if err != nil {
+		return tasks.FormatOptions{}, err
+	}
 
-			code := strings.TrimSpace(roster.Code)
-			if code == "" {
-				continue
-			}
+	options := tasks.FormatOptions{
+		TimeHeaders:         o.TimeHeaders,
+		InstructorHeaders:   o.InstructorHeaders,
+		CourseHeaders:       o.CourseHeaders,
+		Borders:             o.Borders,
+		CenterTime:          o.CenterTime,
+		BoldTime:            o.BoldTime,
+		CenterCourse:        o.CenterCourse,
+		BoldCourse:          o.BoldCourse,
+		NameDisplay:         nameDisplay,
+		ShowAge:             o.ShowAge,
+		ShowGuardian:        o.ShowGuardian,
+		ShowMedicalAlerts:   o.ShowMedicalAlerts,
+		SortOrder:           sortOrder,
+		Layout:              layout,
+		FreezeHeader:        o.FreezeHeader,
+		AutoFilter:          o.AutoFilter,
+		Orientation:         orientation,
+		FitToWidth:          o.FitToWidth,
+		RepeatHeader:        o.RepeatHeader,
+		PageBreaks:          pageBreaks,
+		HeaderFooter:        o.HeaderFooter != nil && *o.HeaderFooter,
+		SessionName:         o.SessionName,
+		PDFPage:             pdfPage,
+		PDFRenderer:         pdfRenderer,
+		KeepClassTogether:   o.KeepTogether,
+		ContinuedHeaders:    o.ContinuedHeaders,
+		ShowCapacity:        o.ShowCapacity,
+		HighlightEnrollment: o.HighlightEnrollment,
+		ClassTotals:         o.ClassTotals,
+		TimeTotals:          o.TimeTotals,
+		LevelTotals:         o.LevelTotals,
+		InstructorTotals:    o.InstructorTotals,
+		GrandTotal:          o.GrandTotal,
+		ShowClassCount:      o.ShowClassCount,
+		Columns:             columns,
+	}
+	return applyPageDefaults(options, o.HeaderFooter != nil)
+}
 
-			serviceName := strings.TrimSpace(roster.ServiceName)
-			if serviceName == "" {
-				serviceName = strings.TrimSpace(student.Level)
-			}
+const invalidMasterListFormat = "Invalid format; use xlsx, pdf, csv or html"
 
-			instructor := strings.TrimSpace(roster.Instructor)
-			if instructor == "" {
-				instructor = strings.TrimSpace(student.Instructor)
+// writeMasterList lays rosters out once and writes them in format. Conflicts
+// go in a header, as every format is a download.
+func writeMasterList(
+	w http.ResponseWriter,
+	r *http.Request,
+	format tasks.MasterListFormat,
+	rosters []tasks.ClassRoster,
+	options tasks.FormatOptions,
+	conflicts []tasks.InstructorConflict,
+) {
+	if format == tasks.MasterListPDF && options.ContinuedHeaders && options.PDFRenderer == tasks.PDFRendererChrome {
+		http.Error(w, "continued_headers needs the native or auto pdf_renderer; Chrome cannot repeat them", http.StatusBadRequest)
+		return
+	}
+	var (
+		data        []byte
+		contentType string
+		disposition = "attachment"
+		err         error
+	)
+	if format == tasks.MasterListXLSX {
+		data, err = tasks.WriteMasterListWorkbook(rosters, options)
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	} else {
+		var sections []tasks.MasterListSection
+		sections, err = tasks.MasterListSections(rosters, options)
+		if err == nil {
+			switch format {
+			case tasks.MasterListCSV:
+				data, err = tasks.WriteMasterListCSV(sections)
+				contentType = "text/csv; charset=utf-8"
+			case tasks.MasterListHTML:
+				data = []byte(buildMasterListHTML(sections, options))
+				contentType, disposition = "text/html; charset=utf-8", "inline"
+			case tasks.MasterListPDF:
+				var renderer tasks.PDFRenderer
+				data, renderer, err = renderMasterListSectionsPDF(r.Context(), sections, options, tasks.MeetingDayNames(rosters))
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Unable to render master list PDF: %v", err), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("X-PDF-Renderer", string(renderer))
+				contentType, disposition = "application/pdf", "inline"
 			}
-
-			rows = append(rows, masterListRow{
-				kind: masterListRowData,
-				cells: []string{
-					code,
-					timeValue,
-					instructor,
-					serviceName,
-					name,
-					strings.TrimSpace(student.Phone),
-				},
-			})
-			dataCount++
 		}
 	}
-
-	if dataCount == 0 {
-		return nil, errors.New("no student rows to process")
+	if errors.Is(err, tasks.ErrEmptyMasterList) {
+		http.Error(w, fmt.Sprintf("Error building master list: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building master list: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	return rows, nil
+	writeConflictsHeader(w, conflicts)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, tasks.MasterListFilename(format)))
+	w.Write(data)
 }
 
-func buildMasterListHTML(rows []masterListRow, options masterListRosterOptions) string {
+// buildMasterListHTML prints each section as its own table, starting a new
+// page for every section after the first. Each class is a tbody of its own,
+// so Chrome can keep it on one page and break pages between time blocks.
+// The renderer waits for the first table, which carries the table ID.
+func buildMasterListHTML(sections []tasks.MasterListSection, options tasks.FormatOptions) string {
 	const (
 		tableID = "masterlist-table"
 	)
-	headers := []string{
-		"EventID",
-		"EventTime",
-		"Instructor",
-		"ServiceName",
-		"AttendeeName",
-		"AttendeePhone",
-	}
 
 	borderClass := "no-borders"
 	if options.Borders {
 		borderClass = "with-borders"
 	}
 
+	page := options.PDFPage.WithDefaults(tasks.PDFPageSetup{})
+	width, height := page.PageInches(options.Orientation)
+	marginX, marginY := page.Margins(options.HeaderFooter)
+
 	var buf bytes.Buffer
 	buf.WriteString("<!doctype html><html><head><meta charset=\"utf-8\"/>")
 	buf.WriteString("<title>Masterlist</title>")
 	buf.WriteString("<style>")
-	buf.WriteString(`@page { size: Letter; margin: 0.35in; }
-* { box-sizing: border-box; }
+	buf.WriteString(fmt.Sprintf("@page { size: %.2fin %.2fin; margin: %.2fin %.2fin; }\n", width, height, marginY, marginX))
+	buf.WriteString(`* { box-sizing: border-box; }
 body { margin: 0; font-family: "Arial", sans-serif; color: #111; }
 table { width: 100%; border-collapse: collapse; table-layout: fixed; }
 thead { display: table-header-group; }
-th, td { padding: 2px 4px; font-size: 9px; vertical-align: top; word-break: break-word; }
+th, td { padding: 2px 4px; font-size: ` + fmt.Sprintf("%gpx", page.FontSize) + `; vertical-align: top; word-break: break-word; }
 .` + borderClass + ` th, .` + borderClass + ` td { border: 1px solid #000; }
 .no-borders th, .no-borders td { border: none; }
 .header-row td { background: #f4f4f4; }
 .header-row.bold td { font-weight: 700; }
 .header-row.center td { text-align: center; }
-tr { page-break-inside: avoid; }`)
+.header-row.enrollment-single td { background: #f43f5e; color: #fff; }
+.header-row.enrollment-low td { background: #f59e0b; }
+.total-row td { background: #e5e7eb; font-weight: 700; }
+.section + .section { page-break-before: always; }
+.section-title { margin: 0 0 6px; font-size: ` + fmt.Sprintf("%gpx", page.FontSize*1.5) + `; }
+tr { page-break-inside: avoid; }
+tbody.keep { break-inside: avoid; }
+tbody.keep .header-row { break-after: avoid; }
+tbody.page-break { break-before: page; }`)
 	buf.WriteString("</style></head><body>")
-	buf.WriteString("<table id=\"" + tableID + "\" class=\"" + borderClass + "\">")
-	buf.WriteString("<colgroup>")
-	for _, width := range buildMasterListColumnWidths(rows, headers) {
-		buf.WriteString(fmt.Sprintf("<col style=\"width:%.2f%%\"/>", width))
-	}
-	buf.WriteString("</colgroup>")
-	buf.WriteString("<thead><tr>")
-	for _, header := range headers {
-		buf.WriteString("<th>")
-		buf.WriteString(html.EscapeString(header))
-		buf.WriteString("</th>")
-	}
-	buf.WriteString("</tr></thead><tbody>")
-
-	for _, row := range rows {
-		switch row.kind {
-		case masterListRowData:
-			buf.WriteString("<tr>")
-			for _, cell := range row.cells {
-				buf.WriteString("<td>")
-				buf.WriteString(html.EscapeString(cell))
-				buf.WriteString("</td>")
+
+	for i, section := range sections {
+		headers := section.List.Labels()
+		buf.WriteString("<section class=\"section\">")
+		if section.Title != "" {
+			buf.WriteString("<h2 class=\"section-title\">")
+			buf.WriteString(html.EscapeString(section.Title))
+			buf.WriteString("</h2>")
+		}
+		buf.WriteString("<table")
+		if i == 0 {
+			buf.WriteString(" id=\"" + tableID + "\"")
+		}
+		buf.WriteString(" class=\"" + borderClass + "\">")
+		buf.WriteString("<colgroup>")
+		for _, width := range tasks.MasterListColumnPercents(section.List) {
+			buf.WriteString(fmt.Sprintf("<col style=\"width:%.2f%%\"/>", width))
+		}
+		buf.WriteString("</colgroup>")
+		buf.WriteString("<thead><tr>")
+		for _, header := range headers {
+			buf.WriteString("<th>")
+			buf.WriteString(html.EscapeString(header))
+			buf.WriteString("</th>")
+		}
+		buf.WriteString("</tr></thead>")
+
+		for _, group := range tasks.MasterListPageGroups(section.List.Rows, options.PageBreaks) {
+			groupClasses := []string{}
+			if options.KeepClassTogether {
+				groupClasses = append(groupClasses, "keep")
 			}
-			buf.WriteString("</tr>")
-		case masterListRowTimeHeader, masterListRowCourseHeader:
-			className := buildMasterListHeaderClass(row.kind, options)
-			buf.WriteString("<tr class=\"header-row")
-			if className != "" {
-				buf.WriteString(" ")
-				buf.WriteString(className)
+			if group.Break {
+				groupClasses = append(groupClasses, "page-break")
 			}
-			buf.WriteString("\"><td colspan=\"6\">")
-			buf.WriteString(html.EscapeString(row.label))
-			buf.WriteString("</td></tr>")
+			buf.WriteString("<tbody")
+			if len(groupClasses) > 0 {
+				buf.WriteString(" class=\"" + strings.Join(groupClasses, " ") + "\"")
+			}
+			buf.WriteString(">")
+			for _, row := range group.Rows {
+				switch row.Kind {
+				case tasks.MasterListStudentRow:
+					buf.WriteString("<tr>")
+					for _, cell := range row.Cells {
+						buf.WriteString("<td>")
+						buf.WriteString(html.EscapeString(cell))
+						buf.WriteString("</td>")
+					}
+					buf.WriteString("</tr>")
+				case tasks.MasterListTimeHeader, tasks.MasterListCourseHeader:
+					className := buildMasterListHeaderClass(row, options)
+					buf.WriteString("<tr class=\"header-row")
+					if className != "" {
+						buf.WriteString(" ")
+						buf.WriteString(className)
+					}
+					buf.WriteString(fmt.Sprintf("\"><td colspan=\"%d\">", len(headers)))
+					buf.WriteString(html.EscapeString(row.Label))
+					buf.WriteString("</td></tr>")
+				case tasks.MasterListTotalRow:
+					buf.WriteString("<tr class=\"total-row\">")
+					if len(headers) > 1 {
+						buf.WriteString(fmt.Sprintf("<td colspan=\"%d\">", len(headers)-1))
+						buf.WriteString(html.EscapeString(row.Label))
+						buf.WriteString(fmt.Sprintf("</td><td>%d</td></tr>", row.Count))
+					} else {
+						buf.WriteString("<td>")
+						buf.WriteString(html.EscapeString(fmt.Sprintf("%s: %d", row.Label, row.Count)))
+						buf.WriteString("</td></tr>")
+					}
+				}
+			}
+			buf.WriteString("</tbody>")
 		}
+		buf.WriteString("</table></section>")
 	}
 
-	buf.WriteString("</tbody></table></body></html>")
+	buf.WriteString("</body></html>")
 	return buf.String()
 }
 
-func buildMasterListHeaderClass(kind masterListRowKind, options masterListRosterOptions) string {
-	classes := make([]string, 0, 2)
-	switch kind {
-	case masterListRowTimeHeader:
+func buildMasterListHeaderClass(row tasks.MasterListRow, options tasks.FormatOptions) string {
+	classes := make([]string, 0, 3)
+	switch row.Kind {
+	case tasks.MasterListTimeHeader:
 		if options.BoldTime {
 			classes = append(classes, "bold")
 		}
 		if options.CenterTime {
 			classes = append(classes, "center")
 		}
-	case masterListRowCourseHeader:
+	case tasks.MasterListCourseHeader:
 		if options.BoldCourse {
 			classes = append(classes, "bold")
 		}
 		if options.CenterCourse {
 			classes = append(classes, "center")
 		}
+		if options.HighlightEnrollment && row.Enrollment != tasks.EnrollmentOK {
+			classes = append(classes, "enrollment-"+string(row.Enrollment))
+		}
 	}
 	return strings.Join(classes, " ")
 }
 
-func buildMasterListColumnWidths(rows []masterListRow, headers []string) []float64 {
-	maxLengths := make([]int, len(headers))
-	for i, header := range headers {
-		maxLengths[i] = len([]rune(header))
+// renderMasterListSectionsPDF prints the sections with the renderer chosen in
+// options and reports the one used. By default Chrome prints them, and the
+// native renderer takes over when Chrome is missing or fails, or when
+// continued headers are asked for, which only it prints.
+func renderMasterListSectionsPDF(
+	ctx context.Context,
+	sections []tasks.MasterListSection,
+	options tasks.FormatOptions,
+	days string,
+) ([]byte, tasks.PDFRenderer, error) {
+	renderer := options.PDFRenderer
+	if renderer == tasks.PDFRendererAuto && options.ContinuedHeaders {
+		// Chrome repeats no headers but the column headers.
+		renderer = tasks.PDFRendererNative
 	}
-
-	for _, row := range rows {
-		if row.kind != masterListRowData {
-			continue
-		}
-		for i, cell := range row.cells {
-			if i >= len(maxLengths) {
-				break
-			}
-			length := len([]rune(cell))
-			if length > maxLengths[i] {
-				maxLengths[i] = length
-			}
+	if renderer != tasks.PDFRendererNative {
+		data, err := renderMasterListPDF(ctx, buildMasterListHTML(sections, options), masterListPrintOptions(options, days))
+		if err == nil || renderer == tasks.PDFRendererChrome {
+			return data, tasks.PDFRendererChrome, err
 		}
+		log.Printf("masterlist pdf: chrome failed, using native renderer: %v", err)
 	}
+	data, err := tasks.WriteMasterListPDF(sections, options, days)
+	return data, tasks.PDFRendererNative, err
+}
 
-	total := 0
-	for _, length := range maxLengths {
-		if length < 1 {
-			length = 1
-		}
-		total += length
-	}
-	if total == 0 {
-		widths := make([]float64, len(headers))
-		if len(headers) == 0 {
-			return widths
-		}
-		width := 100.0 / float64(len(headers))
-		for i := range widths {
-			widths[i] = width
-		}
-		return widths
-	}
+func renderMasterListPDF(ctx context.Context, htmlContent string, printOptions pdfPrintOptions) ([]byte, error) {
+	return renderHTMLToPDF(ctx, htmlContent, "#masterlist-table", printOptions)
+}
 
-	widths := make([]float64, len(headers))
-	for i, length := range maxLengths {
-		if length < 1 {
-			length = 1
-		}
-		widths[i] = (float64(length) / float64(total)) * 100
-	}
-	return widths
+// pdfPrintOptions are the Chrome print settings a page's CSS cannot carry.
+// Without templates no running header or footer is printed; with only one,
+// Chrome fills the other with its own date and title.
+type pdfPrintOptions struct {
+	scale          float64
+	headerTemplate string
+	footerTemplate string
 }
 
-func renderMasterListPDF(ctx context.Context, htmlContent string) ([]byte, error) {
+var defaultPDFPrintOptions = pdfPrintOptions{scale: tasks.DefaultPDFScale}
+
+func renderHTMLToPDF(ctx context.Context, htmlContent string, readySelector string, printOptions pdfPrintOptions) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
@@ -325,7 +459,7 @@ func renderMasterListPDF(ctx context.Context, htmlContent string) ([]byte, error
 	taskCtx, taskCancel := chromedp.NewContext(allocatorCtx)
 	defer taskCancel()
 
-	file, err := os.CreateTemp("", "masterlist-*.html")
+	file, err := os.CreateTemp("", "print-*.html")
 	if err != nil {
 		return nil, err
 	}
@@ -344,15 +478,21 @@ func renderMasterListPDF(ctx context.Context, htmlContent string) ([]byte, error
 
 	err = chromedp.Run(taskCtx,
 		chromedp.Navigate(fileURL),
-		chromedp.WaitReady("#masterlist-table", chromedp.ByID),
+		chromedp.WaitReady(readySelector, chromedp.ByID),
 		chromedp.Sleep(400*time.Millisecond),
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			var err error
-			pdfBytes, _, err = page.PrintToPDF().
+			params := page.PrintToPDF().
 				WithPrintBackground(true).
 				WithPreferCSSPageSize(true).
-				WithScale(0.9).
-				Do(ctx)
+				WithScale(printOptions.scale)
+			if printOptions.headerTemplate != "" || printOptions.footerTemplate != "" {
+				params = params.
+					WithDisplayHeaderFooter(true).
+					WithHeaderTemplate(printOptions.headerTemplate).
+					WithFooterTemplate(printOptions.footerTemplate)
+			}
+			pdfBytes, _, err = params.Do(ctx)
 			return err
 		}),
 	)
@@ -364,8 +504,3 @@ func renderMasterListPDF(ctx context.Context, htmlContent string) ([]byte, error
 	}
 	return pdfBytes, nil
 }
-
-func buildMasterListPdfFilename() string {
-	now := time.Now()
-	return fmt.Sprintf("MasterList_%d_%d_%d.pdf", now.Month(), now.Day(), now.Year())
-}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"cob-aquatics/tasks"
+)
+
+// rosterDiffHandler compares a new registration export (csv_file) with either
+// a second upload (previous_file) or a stored upload (previous_upload, which
+// may be "latest"). format=pdf returns a printable summary instead of JSON.
+func rosterDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if err := parseUploadForm(w, r); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	day := r.FormValue("day")
+	instructors := parseInstructorAssignment(r)
+
+	current, err := processUploadField(r, "csv_file", r.FormValue("profile"), day, instructors)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	var previous []tasks.ClassRoster
+	previousLabel := ""
+	if _, _, err := r.FormFile("previous_file"); err == nil {
+		result, err := processUploadField(r, "previous_file", r.FormValue("previous_profile"), day, instructors)
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		previous = result.Classes
+		previousLabel = "previous upload"
+	} else {
+		id := strings.TrimSpace(r.FormValue("previous_upload"))
+		if id == "" {
+			http.Error(w, "Missing previous_file or previous_upload", http.StatusBadRequest)
+			return
+		}
+		stored, err := uploads.load(id, day)
+		if err != nil {
+			if errors.Is(err, errUploadNotFound) {
+				http.Error(w, "Previous upload not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Unable to load previous upload: %v", err), http.StatusInternalServerError)
+			return
+		}
+		previous = stored.Classes
+		previousLabel = fmt.Sprintf("upload of %s", stored.CreatedAt.Format("Jan 2, 2006 3:04 PM"))
+	}
+
+	diff := tasks.DiffRosters(previous, current.Classes)
+
+	if strings.EqualFold(r.FormValue("format"), "pdf") {
+		htmlContent := buildRosterDiffHTML(diff, r.FormValue("session"), day, previousLabel)
+		pdfBytes, err := renderHTMLToPDF(r.Context(), htmlContent, "#roster-diff", defaultPDFPrintOptions)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to render roster changes PDF: %v", err), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		filename := fmt.Sprintf("RosterChanges_%d_%d_%d.pdf", now.Month(), now.Day(), now.Year())
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+		w.Write(pdfBytes)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"day":       day,
+		"previous":  previousLabel,
+		"diff":      diff,
+		"conflicts": current.Conflicts,
+	})
+}
+
+func buildRosterDiffHTML(diff tasks.RosterDiff, session string, day string, previousLabel string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html><html><head><meta charset=\"utf-8\"/>")
+	buf.WriteString("<title>Roster changes</title>")
+	buf.WriteString("<style>")
+	buf.WriteString(`@page { size: Letter; margin: 0.5in; }
+* { box-sizing: border-box; }
+body { margin: 0; font-family: "Arial", sans-serif; color: #111; font-size: 11px; }
+h1 { font-size: 16px; margin: 0 0 4px; }
+h2 { font-size: 13px; margin: 14px 0 4px; border-bottom: 1px solid #000; }
+.meta { color: #555; margin-bottom: 8px; }
+.summary span { margin-right: 14px; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 6px; }
+th, td { border: 1px solid #999; padding: 2px 4px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+.class-block { page-break-inside: avoid; margin-bottom: 8px; }
+.status { font-weight: 700; text-transform: uppercase; font-size: 9px; }
+.added { color: #0a6b2b; }
+.dropped { color: #a11; }`)
+	buf.WriteString("</style></head><body><div id=\"roster-diff\">")
+
+	title := "Roster changes"
+	if strings.TrimSpace(session) != "" {
+		title = fmt.Sprintf("%s — %s", title, strings.TrimSpace(session))
+	}
+	buf.WriteString("<h1>" + html.EscapeString(title) + "</h1>")
+	meta := fmt.Sprintf("Compared with %s. Generated %s.", previousLabel, time.Now().Format("Jan 2, 2006 3:04 PM"))
+	if strings.TrimSpace(day) != "" {
+		meta = fmt.Sprintf("Day: %s. %s", strings.TrimSpace(day), meta)
+	}
+	buf.WriteString("<div class=\"meta\">" + html.EscapeString(meta) + "</div>")
+	buf.WriteString(fmt.Sprintf(
+		"<div class=\"summary\"><span>Added: %d</span><span>Dropped: %d</span><span>Transferred: %d</span><span>Classes changed: %d</span><span>New classes: %d</span><span>Removed classes: %d</span></div>",
+		diff.Summary.Added, diff.Summary.Dropped, diff.Summary.Transferred,
+		diff.Summary.ClassesChanged, diff.Summary.ClassesAdded, diff.Summary.ClassesRemoved,
+	))
+
+	if len(diff.Classes) == 0 && len(diff.Transfers) == 0 {
+		buf.WriteString("<p>No changes.</p>")
+	}
+
+	if len(diff.Transfers) > 0 {
+		buf.WriteString("<h2>Transfers</h2><table><thead><tr><th>Student</th><th>From</th><th>To</th><th>Phone</th></tr></thead><tbody>")
+		for _, transfer := range diff.Transfers {
+			buf.WriteString("<tr><td>" + html.EscapeString(transfer.Name) + "</td>")
+			buf.WriteString("<td>" + html.EscapeString(classLabel(transfer.FromService, transfer.FromCode)) + "</td>")
+			buf.WriteString("<td>" + html.EscapeString(classLabel(transfer.ToService, transfer.ToCode)) + "</td>")
+			buf.WriteString("<td>" + html.EscapeString(transfer.Phone) + "</td></tr>")
+		}
+		buf.WriteString("</tbody></table>")
+	}
+
+	if len(diff.Classes) > 0 {
+		buf.WriteString("<h2>Classes</h2>")
+	}
+	for _, class := range diff.Classes {
+		buf.WriteString("<div class=\"class-block\"><table><thead><tr><th colspan=\"2\">")
+		heading := classLabel(class.ServiceName, class.Code)
+		if details := strings.TrimSpace(strings.Join([]string{class.Day, class.Time}, " ")); details != "" {
+			heading = fmt.Sprintf("%s — %s", heading, details)
+		}
+		buf.WriteString(html.EscapeString(heading))
+		buf.WriteString(fmt.Sprintf(" <span class=\"status\">%s</span> (%d → %d)", html.EscapeString(class.Status), class.Before, class.After))
+		buf.WriteString("</th></tr></thead><tbody>")
+		for _, change := range class.Changes {
+			buf.WriteString("<tr><td>Changed " + html.EscapeString(change.Field) + "</td><td>")
+			buf.WriteString(html.EscapeString(change.Before) + " → " + html.EscapeString(change.After) + "</td></tr>")
+		}
+		for _, student := range class.Added {
+			buf.WriteString("<tr><td class=\"added\">Added</td><td>" + html.EscapeString(student.Name) + "</td></tr>")
+		}
+		for _, student := range class.Dropped {
+			buf.WriteString("<tr><td class=\"dropped\">Dropped</td><td>" + html.EscapeString(student.Name) + "</td></tr>")
+		}
+		for _, transfer := range class.TransferIn {
+			buf.WriteString("<tr><td class=\"added\">Moved in</td><td>" + html.EscapeString(transfer.Name) + " (from " + html.EscapeString(classLabel(transfer.FromService, transfer.FromCode)) + ")</td></tr>")
+		}
+		for _, transfer := range class.TransferOut {
+			buf.WriteString("<tr><td class=\"dropped\">Moved out</td><td>" + html.EscapeString(transfer.Name) + " (to " + html.EscapeString(classLabel(transfer.ToService, transfer.ToCode)) + ")</td></tr>")
+		}
+		buf.WriteString("</tbody></table></div>")
+	}
+
+	buf.WriteString("</div></body></html>")
+	return buf.String()
+}
+
+func classLabel(serviceName string, code string) string {
+	serviceName = strings.TrimSpace(serviceName)
+	code = strings.TrimSpace(code)
+	if serviceName == "" {
+		return code
+	}
+	if code == "" {
+		return serviceName
+	}
+	return fmt.Sprintf("%s (%s)", serviceName, code)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cob-aquatics/tasks"
+)
+
+const masterListPresetsFile = "masterlist-presets.json"
+
+var (
+	errPresetNotFound = errors.New("masterlist preset not found")
+	settings          = newSettingsStore(resolveSettingsDir())
+)
+
+// settingsStore keeps small JSON documents, such as saved masterlist
+// presets, on disk. They survive restarts only when SETTINGS_DIR is on
+// persistent storage, such as the volume fly.toml mounts.
+type settingsStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newSettingsStore(dir string) *settingsStore {
+	return &settingsStore{dir: dir}
+}
+
+func resolveSettingsDir() string {
+	if dir := strings.TrimSpace(os.Getenv("SETTINGS_DIR")); dir != "" {
+		return dir
+	}
+	dir := filepath.Join(os.TempDir(), "deck-supervisor-settings")
+	log.Printf("SETTINGS_DIR is not set; presets, page setup and template aliases are saved in %s and lost when the machine restarts", dir)
+	return dir
+}
+
+// read decodes the named document into value. A missing document leaves
+// value untouched.
+func (s *settingsStore) read(name string, value interface{}) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (s *settingsStore) write(name string, value interface{}) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// presets returns the saved masterlist presets sorted by name.
+func (s *settingsStore) presets() ([]tasks.ColumnPreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readPresets()
+}
+
+func (s *settingsStore) readPresets() ([]tasks.ColumnPreset, error) {
+	presets := []tasks.ColumnPreset{}
+	if err := s.read(masterListPresetsFile, &presets); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(presets, func(i, j int) bool {
+		return strings.ToLower(presets[i].Name) < strings.ToLower(presets[j].Name)
+	})
+	return presets, nil
+}
+
+// preset looks a saved preset up by name, ignoring case.
+func (s *settingsStore) preset(name string) (tasks.ColumnPreset, error) {
+	presets, err := s.presets()
+	if err != nil {
+		return tasks.ColumnPreset{}, err
+	}
+	for _, preset := range presets {
+		if strings.EqualFold(preset.Name, strings.TrimSpace(name)) {
+			return preset, nil
+		}
+	}
+	return tasks.ColumnPreset{}, errPresetNotFound
+}
+
+// savePreset adds a preset or replaces the one with the same name.
+func (s *settingsStore) savePreset(preset tasks.ColumnPreset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	presets, err := s.readPresets()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range presets {
+		if strings.EqualFold(presets[i].Name, preset.Name) {
+			presets[i] = preset
+			replaced = true
+		}
+	}
+	if !replaced {
+		presets = append(presets, preset)
+	}
+	return s.write(masterListPresetsFile, presets)
+}
+
+func (s *settingsStore) deletePreset(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	presets, err := s.readPresets()
+	if err != nil {
+		return err
+	}
+	kept := presets[:0]
+	for _, preset := range presets {
+		if !strings.EqualFold(preset.Name, strings.TrimSpace(name)) {
+			kept = append(kept, preset)
+		}
+	}
+	if len(kept) == len(presets) {
+		return errPresetNotFound
+	}
+	return s.write(masterListPresetsFile, kept)
+}
@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttendanceTemplate describes one attendance sheet template, as read from
+// its HTML.
+type AttendanceTemplate struct {
+	// Name is the file name without ".html", as attendance requests pass it.
+	Name        string          `json:"name"`
+	Level       string          `json:"level"`
+	Skills      []string        `json:"skills"`
+	Orientation PageOrientation `json:"orientation"`
+	Modified    time.Time       `json:"lastModified"`
+}
+
+var (
+	templateHeadingPattern = regexp.MustCompile(`(?is)<tr id="student-rows">\s*<td[^>]*>(.*?)<p`)
+	templateTitlePattern   = regexp.MustCompile(`(?is)<title>(.*?)</title>`)
+	templateColumnPattern  = regexp.MustCompile(`(?is)<td class="rotate"[^>]*>(.*?)</td>`)
+	templatePagePattern    = regexp.MustCompile(`(?is)@page\s*\{[^}]*size:[^;}]*\b(landscape|portrait)\b`)
+	templateWidthPattern   = regexp.MustCompile(`(?is)\btable\s*\{[^}]*?\bwidth:\s*(\d+)px`)
+	htmlTagPattern         = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// attendanceRecordColumns are the rotated columns of every template that
+// record attendance and results rather than a skill.
+var attendanceRecordColumns = []string{"previous level", "result", "register in"}
+
+// portraitPageWidth is the width in CSS pixels of a portrait Letter page;
+// templates with wider tables print in landscape.
+const portraitPageWidth = 816
+
+// ParseAttendanceTemplate reads a template's level name from its heading cell,
+// or failing that its title, and its skills from the rotated column headers.
+// The orientation comes from an @page size, or else from the table width.
+func ParseAttendanceTemplate(name string, content string, modified time.Time) AttendanceTemplate {
+	template := AttendanceTemplate{
+		Name:        name,
+		Skills:      []string{},
+		Orientation: OrientationPortrait,
+		Modified:    modified,
+	}
+
+	if match := templateHeadingPattern.FindStringSubmatch(content); match != nil {
+		template.Level = htmlText(match[1])
+	}
+	if match := templateTitlePattern.FindStringSubmatch(content); template.Level == "" && match != nil {
+		template.Level = strings.TrimSuffix(htmlText(match[1]), ".html")
+	}
+	if template.Level == "" {
+		template.Level = name
+	}
+
+	for _, match := range templateColumnPattern.FindAllStringSubmatch(content, -1) {
+		column := htmlText(match[1])
+		if column == "" || isAttendanceRecordColumn(column) {
+			continue
+		}
+		template.Skills = append(template.Skills, column)
+	}
+
+	if match := templatePagePattern.FindStringSubmatch(content); match != nil {
+		template.Orientation = PageOrientation(strings.ToLower(match[1]))
+	} else if match := templateWidthPattern.FindStringSubmatch(content); match != nil {
+		if width, err := strconv.Atoi(match[1]); err == nil && width > portraitPageWidth {
+			template.Orientation = OrientationLandscape
+		}
+	}
+	return template
+}
+
+func isAttendanceRecordColumn(column string) bool {
+	column = strings.ToLower(column)
+	for _, prefix := range attendanceRecordColumns {
+		if strings.HasPrefix(column, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlText returns the text of an HTML fragment with its whitespace
+// collapsed.
+func htmlText(fragment string) string {
+	text := html.UnescapeString(htmlTagPattern.ReplaceAllString(fragment, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
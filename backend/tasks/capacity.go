@@ -0,0 +1,130 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultCapacity is used for levels without a capacity rule.
+const DefaultCapacity = 12
+
+type EnrollmentStatus string
+
+const (
+	EnrollmentOK EnrollmentStatus = "ok"
+	// EnrollmentSingle is a class with one swimmer that is not a private or
+	// inclusion lesson.
+	EnrollmentSingle EnrollmentStatus = "single"
+	// EnrollmentLow is a class less than half full.
+	EnrollmentLow EnrollmentStatus = "low"
+)
+
+// levelCapacities holds the maximum class size of each level, keyed by the
+// level name with spaces removed and lowercased.
+var levelCapacities = map[string]int{
+	"littlesplash1": 4,
+	"littlesplash2": 5,
+	"littlesplash3": 5,
+	"littlesplash4": 5,
+	"littlesplash5": 5,
+	"splash1":       6,
+	"splash2a":      6,
+	"splash2b":      6,
+	"splash3":       7,
+	"splash4":       9,
+	"splash5":       11,
+	"splash6":       11,
+	"splash7":       12,
+	"splash8":       12,
+	"splash9":       12,
+	"splash10":      12,
+	"splashadult1":  8,
+	"splashadult2":  8,
+	"splashadult3":  8,
+	"inclusion":     3,
+	"privatelesson": 1,
+}
+
+var levelNumberPattern = regexp.MustCompile(`\d+`)
+
+// LevelCapacity returns the capacity rule for a level name. Private and
+// inclusion lessons match anywhere in the name, adult and teen levels match
+// by number, and other levels must match exactly.
+func LevelCapacity(level string) int {
+	normalized := strings.ToLower(strings.Join(strings.Fields(level), ""))
+
+	best := ""
+	for key := range levelCapacities {
+		if (strings.Contains(key, "private") || strings.Contains(key, "inclusion")) &&
+			strings.Contains(normalized, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best != "" {
+		return levelCapacities[best]
+	}
+
+	for _, group := range []string{"adult", "teen"} {
+		if !strings.Contains(normalized, group) {
+			continue
+		}
+		if number := levelNumberPattern.FindString(normalized); number != "" {
+			if capacity, ok := levelCapacities["splash"+group+number]; ok {
+				return capacity
+			}
+			return DefaultCapacity
+		}
+	}
+
+	if capacity, ok := levelCapacities[normalized]; ok {
+		return capacity
+	}
+	return DefaultCapacity
+}
+
+// IsExceptionClass reports whether a level is a private or inclusion lesson,
+// which are expected to be small.
+func IsExceptionClass(level string) bool {
+	normalized := strings.ToLower(level)
+	return strings.Contains(normalized, "private") || strings.Contains(normalized, "inclusion")
+}
+
+// EffectiveCapacity is the capacity from the export when it has one,
+// otherwise the capacity rule for the class's level.
+func (r ClassRoster) EffectiveCapacity() int {
+	if r.Capacity > 0 {
+		return r.Capacity
+	}
+	level := r.ServiceName
+	if level == "" && len(r.Students) > 0 {
+		level = r.Students[0].Level
+	}
+	return LevelCapacity(level)
+}
+
+// EnrollmentStatusFor classifies a class's enrollment against its capacity.
+func EnrollmentStatusFor(level string, enrolled int, capacity int) EnrollmentStatus {
+	switch {
+	case enrolled == 1 && !IsExceptionClass(level):
+		return EnrollmentSingle
+	case enrolled < capacity/2:
+		return EnrollmentLow
+	}
+	return EnrollmentOK
+}
+
+// CapacityLabel appends enrollment and capacity to a course header, as in
+// "Splash 3 — 5/7".
+func CapacityLabel(label string, enrolled int, capacity int) string {
+	return fmt.Sprintf("%s — %d/%d", label, enrolled, capacity)
+}
+
+// ClassCountLabel appends the number of students to a course header, as in
+// "Splash 3 (5 students)".
+func ClassCountLabel(label string, students int) string {
+	if students == 1 {
+		return fmt.Sprintf("%s (1 student)", label)
+	}
+	return fmt.Sprintf("%s (%d students)", label, students)
+}
@@ -0,0 +1,250 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type MasterListColumn string
+
+const (
+	ColumnCode          MasterListColumn = "code"
+	ColumnTime          MasterListColumn = "time"
+	ColumnInstructor    MasterListColumn = "instructor"
+	ColumnLevel         MasterListColumn = "level"
+	ColumnName          MasterListColumn = "name"
+	ColumnPhone         MasterListColumn = "phone"
+	ColumnLocation      MasterListColumn = "location"
+	ColumnSchedule      MasterListColumn = "schedule"
+	ColumnDay           MasterListColumn = "day"
+	ColumnAge           MasterListColumn = "age"
+	ColumnGuardian      MasterListColumn = "guardian"
+	ColumnMedicalAlerts MasterListColumn = "medicalAlerts"
+	ColumnStudentCount  MasterListColumn = "studentCount"
+)
+
+var ErrUnknownColumn = errors.New("unknown masterlist column")
+
+// ColumnSpec is one masterlist column and the label printed in its header.
+type ColumnSpec struct {
+	Column MasterListColumn `json:"column"`
+	Label  string           `json:"label,omitempty"`
+}
+
+// ColumnPreset is a named, saved choice of masterlist columns.
+type ColumnPreset struct {
+	Name    string       `json:"name"`
+	Columns []ColumnSpec `json:"columns"`
+}
+
+var masterListColumns = []ColumnSpec{
+	{ColumnCode, "Code"},
+	{ColumnTime, "Time"},
+	{ColumnInstructor, "Instructor"},
+	{ColumnLevel, "Level"},
+	{ColumnName, "Student"},
+	{ColumnPhone, "Phone"},
+	{ColumnLocation, "Location"},
+	{ColumnSchedule, "Schedule"},
+	{ColumnDay, "Day"},
+	{ColumnAge, "Age"},
+	{ColumnGuardian, "Guardian"},
+	{ColumnMedicalAlerts, "Medical Alerts"},
+	{ColumnStudentCount, "Students"},
+}
+
+// MasterListColumns lists every column a masterlist can show, with its
+// default label.
+func MasterListColumns() []ColumnSpec {
+	return append([]ColumnSpec{}, masterListColumns...)
+}
+
+// DefaultMasterListColumns is the original masterlist layout, labelled with
+// the export's own column names, plus any student details opted in to.
+func DefaultMasterListColumns(series bool, options FormatOptions) []ColumnSpec {
+	columns := []ColumnSpec{
+		{ColumnCode, "EventID"},
+		{ColumnTime, "EventTime"},
+		{ColumnInstructor, "Instructor"},
+	}
+	if series {
+		columns = append(columns, ColumnSpec{ColumnLevel, "ServiceName"}, ColumnSpec{ColumnName, "AttendeeName"}, ColumnSpec{ColumnPhone, "AttendeePhone"})
+	} else {
+		columns = append(columns, ColumnSpec{ColumnLevel, "Service"}, ColumnSpec{ColumnName, "AttendeeName"}, ColumnSpec{ColumnPhone, "Phone"})
+	}
+	return withStudentDetails(columns, options)
+}
+
+// InstructorMasterListColumns are the default columns of the instructor
+// layout, a contact sheet for calling families, plus any student details
+// opted in to.
+func InstructorMasterListColumns(options FormatOptions) []ColumnSpec {
+	return withStudentDetails([]ColumnSpec{
+		{ColumnDay, "Day"},
+		{ColumnTime, "Time"},
+		{ColumnLevel, "Level"},
+		{ColumnCode, "Code"},
+		{ColumnName, "Student"},
+		{ColumnPhone, "Phone"},
+	}, options)
+}
+
+func withStudentDetails(columns []ColumnSpec, options FormatOptions) []ColumnSpec {
+	if options.ShowAge {
+		columns = append(columns, ColumnSpec{ColumnAge, "Age"})
+	}
+	if options.ShowGuardian {
+		columns = append(columns, ColumnSpec{ColumnGuardian, "Guardian"})
+	}
+	if options.ShowMedicalAlerts {
+		columns = append(columns, ColumnSpec{ColumnMedicalAlerts, "Medical Alerts"})
+	}
+	return columns
+}
+
+// optedInColumns drops the sensitive student columns options did not opt in
+// to, so that a saved preset naming them does not print them on its own.
+func optedInColumns(columns []ColumnSpec, options FormatOptions) []ColumnSpec {
+	hidden := map[MasterListColumn]bool{
+		ColumnAge:           !options.ShowAge,
+		ColumnGuardian:      !options.ShowGuardian,
+		ColumnMedicalAlerts: !options.ShowMedicalAlerts,
+	}
+	kept := make([]ColumnSpec, 0, len(columns))
+	for _, spec := range columns {
+		if !hidden[spec.Column] {
+			kept = append(kept, spec)
+		}
+	}
+	return kept
+}
+
+// ResolveColumns checks that every column is known and fills in default
+// labels. Sensitive columns still print only when the request opts in to
+// them; see optedInColumns.
+func ResolveColumns(columns []ColumnSpec) ([]ColumnSpec, error) {
+	resolved := make([]ColumnSpec, 0, len(columns))
+	for _, spec := range columns {
+		column := MasterListColumn(strings.TrimSpace(string(spec.Column)))
+		label := ""
+		for _, known := range masterListColumns {
+			if strings.EqualFold(string(known.Column), string(column)) {
+				column = known.Column
+				label = known.Label
+				break
+			}
+		}
+		if label == "" {
+			return nil, fmt.Errorf("%w %q", ErrUnknownColumn, spec.Column)
+		}
+		if custom := strings.TrimSpace(spec.Label); custom != "" {
+			label = custom
+		}
+		resolved = append(resolved, ColumnSpec{Column: column, Label: label})
+	}
+	return resolved, nil
+}
+
+// ParseColumnList reads a column choice from a form value: either a JSON
+// array of ColumnSpec or a comma-separated list such as
+// "time,code,name=Swimmer,phone".
+func ParseColumnList(value string) ([]ColumnSpec, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	var columns []ColumnSpec
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &columns); err != nil {
+			return nil, fmt.Errorf("invalid columns: %w", err)
+		}
+	} else {
+		for _, item := range strings.Split(value, ",") {
+			column, label, _ := strings.Cut(item, "=")
+			if strings.TrimSpace(column) == "" {
+				continue
+			}
+			columns = append(columns, ColumnSpec{Column: MasterListColumn(column), Label: label})
+		}
+	}
+	return ResolveColumns(columns)
+}
+
+func columnsInclude(columns []ColumnSpec, wanted ...MasterListColumn) bool {
+	for _, spec := range columns {
+		for _, column := range wanted {
+			if spec.Column == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// masterListEntry is one student row of a masterlist with every column value
+// it can show.
+type masterListEntry struct {
+	values map[MasterListColumn]string
+	// enrolled and capacity describe the student's class.
+	enrolled int
+	capacity int
+}
+
+func (e masterListEntry) enrollmentStatus() EnrollmentStatus {
+	return EnrollmentStatusFor(e.values[ColumnLevel], e.enrolled, e.capacity)
+}
+
+func (e masterListEntry) cells(columns []ColumnSpec) []string {
+	cells := make([]string, len(columns))
+	for i, spec := range columns {
+		cells[i] = e.values[spec.Column]
+	}
+	return cells
+}
+
+// MasterListCells returns the cells of a student's masterlist row.
+func MasterListCells(roster ClassRoster, student RosterStudent, columns []ColumnSpec, display NameDisplay) []string {
+	return rosterEntry(roster, student, display).cells(columns)
+}
+
+func rosterEntry(roster ClassRoster, student RosterStudent, display NameDisplay) masterListEntry {
+	level := strings.TrimSpace(roster.ServiceName)
+	if level == "" {
+		level = strings.TrimSpace(student.Level)
+	}
+	instructor := strings.TrimSpace(roster.Instructor)
+	if instructor == "" {
+		instructor = strings.TrimSpace(student.Instructor)
+	}
+	day := roster.DayLabel
+	if day == "" {
+		day = roster.Day
+	}
+	age := ""
+	if student.Age != nil {
+		age = strconv.Itoa(*student.Age)
+	}
+
+	return masterListEntry{
+		values: map[MasterListColumn]string{
+			ColumnCode:          strings.TrimSpace(roster.Code),
+			ColumnTime:          strings.TrimSpace(roster.Time),
+			ColumnInstructor:    instructor,
+			ColumnLevel:         level,
+			ColumnName:          student.DisplayName(display),
+			ColumnPhone:         strings.TrimSpace(student.Phone),
+			ColumnLocation:      strings.TrimSpace(roster.Location),
+			ColumnSchedule:      strings.TrimSpace(roster.Schedule),
+			ColumnDay:           strings.TrimSpace(day),
+			ColumnAge:           age,
+			ColumnGuardian:      student.Guardian,
+			ColumnMedicalAlerts: strings.Join(student.MedicalAlerts, "; "),
+			ColumnStudentCount:  strconv.Itoa(len(roster.Students)),
+		},
+		enrolled: len(roster.Students),
+		capacity: roster.EffectiveCapacity(),
+	}
+}
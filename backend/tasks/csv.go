@@ -1,117 +1,234 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type RosterStudent struct {
-	Name       string `json:"name"`
-	Phone      string `json:"phone"`
-	Instructor string `json:"instructor"`
-	Level      string `json:"level"`
+	Name          string   `json:"name"`
+	FirstName     string   `json:"firstName,omitempty"`
+	LastName      string   `json:"lastName,omitempty"`
+	PreferredName string   `json:"preferredName,omitempty"`
+	Phone         string   `json:"phone"`
+	Instructor    string   `json:"instructor"`
+	Level         string   `json:"level"`
+	Birthdate     string   `json:"birthdate,omitempty"`
+	Age           *int     `json:"age,omitempty"`
+	Guardian      string   `json:"guardian,omitempty"`
+	MedicalAlerts []string `json:"medicalAlerts,omitempty"`
 }
 
 type ClassRoster struct {
 	Code        string          `json:"code"`
 	ServiceName string          `json:"serviceName"`
 	Day         string          `json:"day"`
+	Days        []string        `json:"days"`
+	DayLabel    string          `json:"dayLabel"`
 	Time        string          `json:"time"`
 	Location    string          `json:"location"`
 	Schedule    string          `json:"schedule"`
 	Instructor  string          `json:"instructor"`
+	Capacity    int             `json:"capacity,omitempty"`
+	Timing      *ClassSchedule  `json:"timing,omitempty"`
 	Students    []RosterStudent `json:"students"`
 }
 
-func ProcessCSV(records [][]string, instructorMap map[string]string, fallbackDay string) ([]ClassRoster, int, error) {
-	if len(records) < 2 {
-		return nil, 0, fmt.Errorf("no rows to process")
+var (
+	ErrNoRows     = errors.New("no rows to process")
+	ErrNoStudents = errors.New("no student rows could be imported")
+)
+
+type CSVOptions struct {
+	// ProfileName selects an import profile; empty detects it from the header.
+	ProfileName string
+	FallbackDay string
+	HeaderRow   int
+	NameDisplay NameDisplay
+	// SessionStart is the date ages are computed on; zero uses each class's
+	// first meeting.
+	SessionStart time.Time
+	SortOrder    SortOrder
+}
+
+type CSVResult struct {
+	Profile     ImportProfile
+	Classes     []ClassRoster
+	Total       int
+	Diagnostics []RowDiagnostic
+	Conflicts   []InstructorConflict
+}
+
+func ProcessCSV(records [][]string, options CSVOptions, instructors InstructorAssignment) (CSVResult, error) {
+	return ProcessCSVRows(NewSliceRowReader(records, options.HeaderRow), options, instructors)
+}
+
+// ProcessCSVRows builds class rosters from a stream of rows whose first row is
+// the header.
+func ProcessCSVRows(rows RowReader, options CSVOptions, instructors InstructorAssignment) (CSVResult, error) {
+	headers, err := rows.Read()
+	if errors.Is(err, io.EOF) {
+		return CSVResult{}, ErrNoRows
+	}
+	if err != nil {
+		return CSVResult{}, err
 	}
 
-	headers := records[0]
-	headerIndex := map[string]int{}
-	for i, header := range headers {
-		normalized := normalizeHeader(header)
-		if normalized == "" {
-			continue
-		}
-		headerIndex[normalized] = i
+	profile, err := SelectImportProfile(options.ProfileName, headers)
+	if err != nil {
+		return CSVResult{}, err
+	}
+	columns := profile.columnIndex(headers)
+	if _, ok := columns[FieldCode]; !ok {
+		return CSVResult{Profile: profile}, fmt.Errorf("no class code column for import profile %q", profile.Name)
 	}
 
-	getByName := func(row []string, names []string) string {
-		for _, name := range names {
-			if idx, ok := headerIndex[normalizeHeader(name)]; ok && idx < len(row) {
-				return strings.TrimSpace(row[idx])
-			}
+	columnLabel := func(field ImportField) string {
+		if idx, ok := columns[field]; ok && idx < len(headers) {
+			return strings.TrimPrefix(strings.TrimSpace(headers[idx]), "\uFEFF")
+		}
+		if aliases := profile.Columns[field]; len(aliases) > 0 {
+			return aliases[0]
 		}
-		return ""
+		return string(field)
 	}
 
 	classMap := map[string]*ClassRoster{}
+	seenStudents := map[string]bool{}
+	diagnostics := []RowDiagnostic{}
 	totalStudents := 0
+	dataRows := 0
 
-	for i := 1; i < len(records); i++ {
-		row := records[i]
-		if len(row) == 0 {
+	for {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return CSVResult{Profile: profile, Diagnostics: diagnostics}, err
+		}
+		if isBlankRow(row) {
 			continue
 		}
+		dataRows++
+		rowNumber := rows.RowNumber()
+		report := func(field ImportField, severity Severity, action RowAction, reason, value, code string) {
+			diagnostics = append(diagnostics, RowDiagnostic{
+				Row:      rowNumber,
+				Column:   columnLabel(field),
+				Severity: severity,
+				Action:   action,
+				Reason:   reason,
+				Value:    value,
+				Code:     code,
+			})
+		}
 
-		serviceName := getByName(row, []string{"ServiceName", "Service", "Service Name"})
-		code := getByName(row, []string{"EventID", "Event Id", "ClassCode", "Code"})
-		day := getByName(row, []string{"Day", "DayOfWeek"})
-		timeValue := getByName(row, []string{"EventTime", "Time"})
-		location := getByName(row, []string{"Location", "Facility"})
-		schedule := getByName(row, []string{"EventSchedule", "Schedule"})
-		phone := getByName(row, []string{"AttendeePhone", "Phone"})
+		serviceName := columns.get(row, FieldServiceName)
+		code := columns.get(row, FieldCode)
+		day := profile.classDay(row, columns)
+		timeValue := columns.get(row, FieldTime)
+		location := columns.get(row, FieldLocation)
+		schedule := columns.get(row, FieldSchedule)
+		phone := columns.get(row, FieldPhone)
+		personName := profile.studentName(row, columns)
+		name := personName.Display(options.NameDisplay)
 
-		name := getByName(row, []string{"AttendeeName", "Name"})
-		if strings.Contains(name, ",") {
-			parts := strings.SplitN(name, ",", 2)
-			name = strings.TrimSpace(parts[1]) + " " + strings.TrimSpace(parts[0])
+		if code == "" {
+			report(FieldCode, SeverityError, RowDropped, "missing class code", "", "")
 		}
 		if name == "" {
-			firstName := getByName(row, []string{"FirstName", "First Name"})
-			lastName := getByName(row, []string{"LastName", "Last Name"})
-			if firstName != "" || lastName != "" {
-				name = strings.TrimSpace(strings.Join([]string{firstName, lastName}, " "))
-			}
+			report(FieldName, SeverityError, RowDropped, "blank student name", "", code)
 		}
-
 		if name == "" || code == "" {
 			continue
 		}
 
+		if timeValue == "" {
+			report(FieldTime, SeverityWarning, RowImported, "missing class time", "", code)
+		} else if _, _, ok := parseTimeRange(timeValue); !ok {
+			report(FieldTime, SeverityWarning, RowImported, "unparsable class time", timeValue, code)
+		}
+
+		rawDay := day
 		if day == "" {
-			day = fallbackDay
+			day = strings.TrimSpace(options.FallbackDay)
+		}
+		dayLabel := day
+		days, knownDay := ParseDays(day)
+		if !knownDay {
+			days = []string{}
 		}
 		day = normalizeDay(day)
+		if day == "" {
+			report(FieldDay, SeverityWarning, RowImported, "no day given and no fallback day selected", "", code)
+		} else if !knownDay {
+			report(FieldDay, SeverityWarning, RowImported, "unknown day", rawDay, code)
+		}
+		if schedule != "" && len(findDates(schedule)) == 0 && !isKnownDay(schedule) {
+			report(FieldSchedule, SeverityWarning, RowImported, "no dates found in schedule", schedule, code)
+		}
 		if schedule == "" {
 			schedule = day
 		}
 
-		instructor := instructorMap[code]
+		instructor := instructors.Instructor(code)
 		level := serviceName
 
 		roster, ok := classMap[code]
 		if !ok {
+			timing := ParseSchedule(timeValue, day, schedule)
 			roster = &ClassRoster{
 				Code:        code,
 				ServiceName: serviceName,
 				Day:         day,
+				Days:        days,
+				DayLabel:    dayLabel,
 				Time:        timeValue,
 				Location:    location,
 				Schedule:    schedule,
 				Instructor:  instructor,
+				Capacity:    parseCapacity(columns.get(row, FieldCapacity)),
+				Timing:      &timing,
 				Students:    []RosterStudent{},
 			}
 			classMap[code] = roster
+		} else {
+			if roster.Time != timeValue {
+				report(FieldTime, SeverityWarning, RowImported, fmt.Sprintf("class time differs from earlier rows (%s)", roster.Time), timeValue, code)
+			}
+			if roster.ServiceName != serviceName {
+				report(FieldServiceName, SeverityWarning, RowImported, fmt.Sprintf("service name differs from earlier rows (%s)", roster.ServiceName), serviceName, code)
+			}
+		}
+
+		details, badBirthdate := readStudentDetails(row, columns, sessionStartFor(options.SessionStart, *roster.Timing))
+		if badBirthdate != "" {
+			report(FieldBirthdate, SeverityWarning, RowImported, "unparsable birthdate", badBirthdate, code)
 		}
 
+		studentKey := code + "\x00" + strings.ToLower(name)
+		if seenStudents[studentKey] {
+			report(FieldName, SeverityWarning, RowImported, "student is listed more than once in this class", name, code)
+		}
+		seenStudents[studentKey] = true
+
 		roster.Students = append(roster.Students, RosterStudent{
-			Name:       name,
-			Phone:      phone,
-			Instructor: instructor,
-			Level:      level,
+			Name:          name,
+			FirstName:     personName.First,
+			LastName:      personName.Last,
+			PreferredName: personName.Preferred,
+			Phone:         phone,
+			Instructor:    instructor,
+			Level:         level,
+			Birthdate:     details.Birthdate,
+			Age:           details.Age,
+			Guardian:      details.Guardian,
+			MedicalAlerts: details.MedicalAlerts,
 		})
 		totalStudents++
 	}
@@ -120,8 +237,39 @@ func ProcessCSV(records [][]string, instructorMap map[string]string, fallbackDay
 	for _, roster := range classMap {
 		classes = append(classes, *roster)
 	}
+	SortRosters(classes, options.SortOrder)
 
-	return classes, totalStudents, nil
+	result := CSVResult{
+		Profile:     profile,
+		Classes:     classes,
+		Total:       totalStudents,
+		Diagnostics: diagnostics,
+		Conflicts:   instructors.Conflicts(classes),
+	}
+	if dataRows == 0 {
+		return result, ErrNoRows
+	}
+	if totalStudents == 0 {
+		return result, ErrNoStudents
+	}
+	return result, nil
+}
+
+func parseCapacity(value string) int {
+	capacity, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
 }
 
 func normalizeHeader(header string) string {
@@ -130,31 +278,3 @@ func normalizeHeader(header string) string {
 	clean = strings.ToLower(clean)
 	return clean
 }
-
-func normalizeDay(day string) string {
-	value := strings.TrimSpace(day)
-	if value == "" {
-		return value
-	}
-	if value == "Mo Tu We Th Fr" {
-		return "Mo,Tu,We,Th,Fr"
-	}
-	normalized := strings.ToLower(value)
-	switch normalized {
-	case "monday":
-		return "Mo"
-	case "tuesday":
-		return "Tu"
-	case "wednesday":
-		return "We"
-	case "thursday":
-		return "Th"
-	case "friday":
-		return "Fr"
-	case "saturday":
-		return "Sa"
-	case "sunday":
-		return "Su"
-	}
-	return value
-}
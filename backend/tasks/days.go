@@ -0,0 +1,227 @@
+package tasks
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	weekdayOrder       = []string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"}
+	weekdayNames       = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+	daySeparatorRegexp = regexp.MustCompile(`(?i)\s+and\s+|[,/&+;|]`)
+	dayRangeRegexp     = regexp.MustCompile(`\s*(?:-|–|—|\bto\b|\bthru\b|\bthrough\b)\s*`)
+)
+
+// ParseDays reads any combination of day tokens: abbreviations ("Tu", "Thu"),
+// full names, separators ("Tu/Th", "Sat & Sun", "Mon, Wed", "Mon-Wed-Fri"),
+// ranges ("Mo-Fr", "Monday to Friday") and run-together codes ("MoWeFr").
+// It returns the weekday codes in week order and whether every token was
+// recognised.
+func ParseDays(value string) ([]string, bool) {
+	clean := strings.TrimSpace(value)
+	if clean == "" {
+		return nil, false
+	}
+	clean = daySeparatorRegexp.ReplaceAllString(clean, " ")
+	clean = dayRangeRegexp.ReplaceAllString(clean, "-")
+
+	seen := map[string]bool{}
+	for _, token := range strings.Fields(clean) {
+		token = strings.Trim(token, ".-")
+		if token == "" {
+			continue
+		}
+		codes, ok := parseDayToken(token)
+		if !ok {
+			return nil, false
+		}
+		for _, code := range codes {
+			seen[code] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil, false
+	}
+
+	days := make([]string, 0, len(seen))
+	for _, code := range weekdayOrder {
+		if seen[code] {
+			days = append(days, code)
+		}
+	}
+	return days, true
+}
+
+// parseDayToken reads one day, a run of codes, a range such as "Mo-Fr" or a
+// dashed list of three or more days such as "Mon-Wed-Fri".
+func parseDayToken(token string) ([]string, bool) {
+	parts := strings.Split(token, "-")
+	if len(parts) == 2 {
+		start, ok := dayCode(parts[0])
+		if !ok {
+			return nil, false
+		}
+		end, ok := dayCode(parts[1])
+		if !ok {
+			return nil, false
+		}
+		return dayRange(start, end), true
+	}
+	if len(parts) > 2 {
+		codes := []string{}
+		for _, part := range parts {
+			code, ok := dayCode(part)
+			if !ok {
+				return nil, false
+			}
+			codes = append(codes, code)
+		}
+		return codes, true
+	}
+
+	if code, ok := dayCode(token); ok {
+		return []string{code}, true
+	}
+
+	if len(token)%2 != 0 || len(token) < 4 {
+		return nil, false
+	}
+	codes := []string{}
+	for i := 0; i < len(token); i += 2 {
+		code, ok := dayCode(token[i : i+2])
+		if !ok {
+			return nil, false
+		}
+		codes = append(codes, code)
+	}
+	return codes, true
+}
+
+func dayRange(start, end string) []string {
+	startIndex := weekdayIndex(start)
+	endIndex := weekdayIndex(end)
+	days := []string{}
+	for i := startIndex; ; i = (i + 1) % len(weekdayOrder) {
+		days = append(days, weekdayOrder[i])
+		if i == endIndex {
+			break
+		}
+	}
+	return days
+}
+
+func weekdayIndex(code string) int {
+	for i, day := range weekdayOrder {
+		if day == code {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeDay turns a recognised day string into its comma-joined codes
+// ("Mo,Tu,We,Th,Fr") and leaves anything else as it was.
+func normalizeDay(day string) string {
+	value := strings.TrimSpace(day)
+	if days, ok := ParseDays(value); ok {
+		return strings.Join(days, ",")
+	}
+	return value
+}
+
+func isKnownDay(day string) bool {
+	_, ok := ParseDays(day)
+	return ok
+}
+
+func isDayToken(token string) bool {
+	_, ok := parseDayToken(strings.TrimSpace(token))
+	return ok
+}
+
+func dayCode(token string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(token)) {
+	case "mo", "mon", "monday":
+		return "Mo", true
+	case "tu", "tue", "tues", "tuesday":
+		return "Tu", true
+	case "we", "wed", "wednesday":
+		return "We", true
+	case "th", "thu", "thur", "thurs", "thursday":
+		return "Th", true
+	case "fr", "fri", "friday":
+		return "Fr", true
+	case "sa", "sat", "saturday":
+		return "Sa", true
+	case "su", "sun", "sunday":
+		return "Su", true
+	}
+	return "", false
+}
+
+// DayName returns the full name of a day code, or the code itself when it is
+// not one.
+func DayName(code string) string {
+	if index := weekdayIndex(code); index >= 0 {
+		return weekdayNames[index]
+	}
+	return code
+}
+
+// MeetingDays returns the day codes the class meets on, parsing Day for
+// rosters that were built without them.
+func (r ClassRoster) MeetingDays() []string {
+	if len(r.Days) > 0 {
+		return r.Days
+	}
+	days, _ := ParseDays(r.Day)
+	return days
+}
+
+// RostersForDay returns the classes that meet on the given day code,
+// including multi-day classes.
+func RostersForDay(classes []ClassRoster, day string) []ClassRoster {
+	code, ok := dayCode(day)
+	if !ok {
+		return nil
+	}
+	matches := []ClassRoster{}
+	for _, roster := range classes {
+		for _, meeting := range roster.MeetingDays() {
+			if meeting == code {
+				matches = append(matches, roster)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// ClassCodesByDay maps every day code to the classes meeting that day.
+func ClassCodesByDay(classes []ClassRoster) map[string][]string {
+	byDay := map[string][]string{}
+	for _, roster := range classes {
+		for _, day := range roster.MeetingDays() {
+			byDay[day] = append(byDay[day], roster.Code)
+		}
+	}
+	return byDay
+}
+
+// MeetingDayNames lists the full names of the days any of the classes meet
+// on, in week order, as in "Saturday, Sunday".
+func MeetingDayNames(classes []ClassRoster) string {
+	meets := map[string]bool{}
+	for _, roster := range classes {
+		for _, day := range roster.MeetingDays() {
+			meets[day] = true
+		}
+	}
+	names := []string{}
+	for _, day := range weekdayOrder {
+		if meets[day] {
+			names = append(names, DayName(day))
+		}
+	}
+	return strings.Join(names, ", ")
+}
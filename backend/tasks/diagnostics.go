@@ -0,0 +1,48 @@
+package tasks
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type RowAction string
+
+const (
+	RowDropped  RowAction = "dropped"
+	RowImported RowAction = "imported"
+)
+
+// RowDiagnostic describes a problem with one row of an upload. Row is the
+// 1-based row number in the uploaded file, counting the header row.
+type RowDiagnostic struct {
+	Row      int       `json:"row"`
+	Column   string    `json:"column"`
+	Severity Severity  `json:"severity"`
+	Action   RowAction `json:"action"`
+	Reason   string    `json:"reason"`
+	Value    string    `json:"value,omitempty"`
+	Code     string    `json:"code,omitempty"`
+}
+
+type DiagnosticSummary struct {
+	Dropped  int `json:"dropped"`
+	Warnings int `json:"warnings"`
+}
+
+func SummarizeDiagnostics(diagnostics []RowDiagnostic) DiagnosticSummary {
+	summary := DiagnosticSummary{}
+	dropped := map[int]bool{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Action == RowDropped {
+			dropped[diagnostic.Row] = true
+			continue
+		}
+		if diagnostic.Severity == SeverityWarning {
+			summary.Warnings++
+		}
+	}
+	summary.Dropped = len(dropped)
+	return summary
+}
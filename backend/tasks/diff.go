@@ -0,0 +1,310 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	ClassAdded   = "added"
+	ClassRemoved = "removed"
+	ClassChanged = "changed"
+)
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type StudentTransfer struct {
+	Name        string `json:"name"`
+	Phone       string `json:"phone"`
+	FromCode    string `json:"fromCode"`
+	FromService string `json:"fromService"`
+	ToCode      string `json:"toCode"`
+	ToService   string `json:"toService"`
+}
+
+type ClassDiff struct {
+	Code        string            `json:"code"`
+	ServiceName string            `json:"serviceName"`
+	Day         string            `json:"day"`
+	Time        string            `json:"time"`
+	Status      string            `json:"status"`
+	Added       []RosterStudent   `json:"added"`
+	Dropped     []RosterStudent   `json:"dropped"`
+	TransferIn  []StudentTransfer `json:"transferIn"`
+	TransferOut []StudentTransfer `json:"transferOut"`
+	Changes     []FieldChange     `json:"changes"`
+	Before      int               `json:"before"`
+	After       int               `json:"after"`
+}
+
+type DiffSummary struct {
+	Added          int `json:"added"`
+	Dropped        int `json:"dropped"`
+	Transferred    int `json:"transferred"`
+	ClassesAdded   int `json:"classesAdded"`
+	ClassesRemoved int `json:"classesRemoved"`
+	ClassesChanged int `json:"classesChanged"`
+}
+
+type RosterDiff struct {
+	Summary   DiffSummary       `json:"summary"`
+	Classes   []ClassDiff       `json:"classes"`
+	Transfers []StudentTransfer `json:"transfers"`
+}
+
+type studentPlacement struct {
+	code    string
+	student RosterStudent
+}
+
+// DiffRosters compares two sets of class rosters. Students are matched
+// within a class by name. A student who leaves one class and appears in
+// another is reported as a transfer rather than as a drop and an add, unless
+// the two have different phone numbers.
+func DiffRosters(previous []ClassRoster, current []ClassRoster) RosterDiff {
+	previousByCode := rostersByCode(previous)
+	currentByCode := rostersByCode(current)
+
+	removedByStudent := map[string][]studentPlacement{}
+	addedByStudent := map[string][]studentPlacement{}
+	studentOrder := []string{}
+	noteStudent := func(key string) {
+		if _, ok := removedByStudent[key]; ok {
+			return
+		}
+		if _, ok := addedByStudent[key]; ok {
+			return
+		}
+		studentOrder = append(studentOrder, key)
+	}
+
+	codes := unionCodes(previousByCode, currentByCode)
+	for _, code := range codes {
+		before := studentCounts(previousByCode[code])
+		after := studentCounts(currentByCode[code])
+		for _, student := range rosterStudents(previousByCode[code]) {
+			key := studentKey(student)
+			if after[key] > 0 {
+				after[key]--
+				continue
+			}
+			noteStudent(key)
+			removedByStudent[key] = append(removedByStudent[key], studentPlacement{code: code, student: student})
+		}
+		for _, student := range rosterStudents(currentByCode[code]) {
+			key := studentKey(student)
+			if before[key] > 0 {
+				before[key]--
+				continue
+			}
+			noteStudent(key)
+			addedByStudent[key] = append(addedByStudent[key], studentPlacement{code: code, student: student})
+		}
+	}
+
+	diffs := map[string]*ClassDiff{}
+	classDiff := func(code string) *ClassDiff {
+		if diff, ok := diffs[code]; ok {
+			return diff
+		}
+		diff := newClassDiff(previousByCode[code], currentByCode[code])
+		diffs[code] = diff
+		return diff
+	}
+
+	result := RosterDiff{Transfers: []StudentTransfer{}}
+	for _, key := range studentOrder {
+		removed := removedByStudent[key]
+		added := addedByStudent[key]
+		moved := make([]bool, len(added))
+		for _, from := range removed {
+			to := -1
+			for i, placement := range added {
+				if !moved[i] && samePhone(from.student, placement.student) {
+					to = i
+					break
+				}
+			}
+			if to < 0 {
+				diff := classDiff(from.code)
+				diff.Dropped = append(diff.Dropped, from.student)
+				result.Summary.Dropped++
+				continue
+			}
+			moved[to] = true
+			transfer := StudentTransfer{
+				Name:        added[to].student.Name,
+				Phone:       added[to].student.Phone,
+				FromCode:    from.code,
+				FromService: serviceNameOf(previousByCode[from.code]),
+				ToCode:      added[to].code,
+				ToService:   serviceNameOf(currentByCode[added[to].code]),
+			}
+			result.Transfers = append(result.Transfers, transfer)
+			classDiff(from.code).TransferOut = append(classDiff(from.code).TransferOut, transfer)
+			classDiff(added[to].code).TransferIn = append(classDiff(added[to].code).TransferIn, transfer)
+		}
+		for i, placement := range added {
+			if moved[i] {
+				continue
+			}
+			diff := classDiff(placement.code)
+			diff.Added = append(diff.Added, placement.student)
+			result.Summary.Added++
+		}
+	}
+	result.Summary.Transferred = len(result.Transfers)
+
+	for _, code := range codes {
+		diff := classDiff(code)
+		unchanged := len(diff.Added) == 0 && len(diff.Dropped) == 0 &&
+			len(diff.TransferIn) == 0 && len(diff.TransferOut) == 0 && len(diff.Changes) == 0
+		if diff.Status == ClassChanged && unchanged {
+			delete(diffs, code)
+		}
+	}
+
+	result.Classes = make([]ClassDiff, 0, len(diffs))
+	for _, code := range codes {
+		diff, ok := diffs[code]
+		if !ok {
+			continue
+		}
+		switch diff.Status {
+		case ClassAdded:
+			result.Summary.ClassesAdded++
+		case ClassRemoved:
+			result.Summary.ClassesRemoved++
+		default:
+			result.Summary.ClassesChanged++
+		}
+		result.Classes = append(result.Classes, *diff)
+	}
+	return result
+}
+
+func newClassDiff(previous *ClassRoster, current *ClassRoster) *ClassDiff {
+	diff := &ClassDiff{
+		Status:      ClassChanged,
+		Added:       []RosterStudent{},
+		Dropped:     []RosterStudent{},
+		TransferIn:  []StudentTransfer{},
+		TransferOut: []StudentTransfer{},
+		Changes:     []FieldChange{},
+	}
+	switch {
+	case previous == nil:
+		diff.Status = ClassAdded
+		fillClassDiff(diff, current)
+	case current == nil:
+		diff.Status = ClassRemoved
+		fillClassDiff(diff, previous)
+	default:
+		fillClassDiff(diff, current)
+		compare := func(field, before, after string) {
+			if strings.TrimSpace(before) != strings.TrimSpace(after) {
+				diff.Changes = append(diff.Changes, FieldChange{Field: field, Before: before, After: after})
+			}
+		}
+		compare("serviceName", previous.ServiceName, current.ServiceName)
+		compare("day", previous.Day, current.Day)
+		compare("time", previous.Time, current.Time)
+		compare("location", previous.Location, current.Location)
+		compare("instructor", previous.Instructor, current.Instructor)
+	}
+	if previous != nil {
+		diff.Before = len(previous.Students)
+	}
+	if current != nil {
+		diff.After = len(current.Students)
+	}
+	return diff
+}
+
+func fillClassDiff(diff *ClassDiff, roster *ClassRoster) {
+	diff.Code = roster.Code
+	diff.ServiceName = roster.ServiceName
+	diff.Day = roster.Day
+	diff.Time = roster.Time
+}
+
+func rostersByCode(rosters []ClassRoster) map[string]*ClassRoster {
+	byCode := map[string]*ClassRoster{}
+	for i := range rosters {
+		code := strings.TrimSpace(rosters[i].Code)
+		if code == "" {
+			continue
+		}
+		if existing, ok := byCode[code]; ok {
+			merged := *existing
+			merged.Students = append(append([]RosterStudent{}, existing.Students...), rosters[i].Students...)
+			byCode[code] = &merged
+			continue
+		}
+		byCode[code] = &rosters[i]
+	}
+	return byCode
+}
+
+func unionCodes(a map[string]*ClassRoster, b map[string]*ClassRoster) []string {
+	codes := make([]string, 0, len(a)+len(b))
+	for code := range a {
+		codes = append(codes, code)
+	}
+	for code := range b {
+		if _, ok := a[code]; !ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func rosterStudents(roster *ClassRoster) []RosterStudent {
+	if roster == nil {
+		return nil
+	}
+	return roster.Students
+}
+
+func serviceNameOf(roster *ClassRoster) string {
+	if roster == nil {
+		return ""
+	}
+	return roster.ServiceName
+}
+
+func studentCounts(roster *ClassRoster) map[string]int {
+	counts := map[string]int{}
+	for _, student := range rosterStudents(roster) {
+		counts[studentKey(student)]++
+	}
+	return counts
+}
+
+func studentKey(student RosterStudent) string {
+	return strings.ToLower(strings.Join(strings.Fields(student.Name), " "))
+}
+
+// samePhone reports whether a student who left one class and a namesake who
+// joined another could be the same child: namesakes with different phones
+// are different children. Guardians are not compared because stored uploads
+// drop them.
+func samePhone(a RosterStudent, b RosterStudent) bool {
+	first := phoneDigits(a.Phone)
+	second := phoneDigits(b.Phone)
+	return first == "" || second == "" || first == second
+}
+
+func phoneDigits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
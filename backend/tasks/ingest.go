@@ -0,0 +1,317 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const textSampleBytes = 64 << 10
+
+var ErrTooManyRows = errors.New("too many rows")
+
+// RowReader yields the rows of an upload one at a time. RowNumber reports the
+// 1-based row number in the source file of the row returned by the last Read.
+type RowReader interface {
+	Read() ([]string, error)
+	RowNumber() int
+}
+
+type TextFormat struct {
+	Encoding  string `json:"encoding"`
+	Delimiter string `json:"delimiter"`
+}
+
+// NewDelimitedRowReader detects the encoding (UTF-8, UTF-16 and Windows-1252)
+// and the delimiter (comma, semicolon or tab) of a text export and returns a
+// reader that streams its rows as UTF-8. Detection only looks at the start of
+// the file.
+func NewDelimitedRowReader(reader io.Reader) (RowReader, TextFormat, error) {
+	buffered := bufio.NewReaderSize(reader, textSampleBytes)
+	sample, err := buffered.Peek(textSampleBytes)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, TextFormat{}, err
+	}
+
+	name, decoding := detectEncoding(sample)
+	decoded := transform.NewReader(buffered, decoding.NewDecoder())
+
+	text := bufio.NewReaderSize(decoded, textSampleBytes)
+	decodedSample, err := text.Peek(textSampleBytes)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, TextFormat{}, fmt.Errorf("decode %s text: %w", name, err)
+	}
+	delimiter := detectDelimiter(decodedSample)
+
+	csvReader := csv.NewReader(text)
+	csvReader.Comma = delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	return &csvRowReader{reader: csvReader}, TextFormat{
+		Encoding:  name,
+		Delimiter: string(delimiter),
+	}, nil
+}
+
+func detectEncoding(sample []byte) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", unicode.UTF8BOM
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+
+	if len(sample) >= 4 {
+		evenZeros, oddZeros := 0, 0
+		limit := len(sample)
+		if limit > 1024 {
+			limit = 1024
+		}
+		for i := 0; i < limit; i++ {
+			if sample[i] != 0 {
+				continue
+			}
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+		half := limit / 2
+		if oddZeros > half*3/10 && evenZeros < half/10 {
+			return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+		}
+		if evenZeros > half*3/10 && oddZeros < half/10 {
+			return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+		}
+	}
+
+	if validUTF8Prefix(sample) {
+		return "utf-8", unicode.UTF8
+	}
+	return "windows-1252", charmap.Windows1252
+}
+
+// validUTF8Prefix reports whether sample is valid UTF-8, allowing a rune cut
+// off by the end of the sample.
+func validUTF8Prefix(sample []byte) bool {
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size <= 1 {
+			return len(sample) < utf8.UTFMax && !utf8.FullRune(sample)
+		}
+		sample = sample[size:]
+	}
+	return true
+}
+
+// detectDelimiter picks the delimiter that occurs most often on any of the
+// first lines, so a title line above the header does not decide it.
+func detectDelimiter(sample []byte) rune {
+	best := ','
+	bestCount := 0
+	lines := bytes.FieldsFunc(sample, func(r rune) bool { return r == '\r' || r == '\n' })
+	for i, line := range lines {
+		if i >= headerScanRows {
+			break
+		}
+		counts := map[rune]int{}
+		inQuotes := false
+		for _, r := range string(line) {
+			switch r {
+			case '"':
+				inQuotes = !inQuotes
+			case ',', ';', '\t':
+				if !inQuotes {
+					counts[r]++
+				}
+			}
+		}
+		for _, candidate := range []rune{',', ';', '\t'} {
+			if counts[candidate] > bestCount {
+				best = candidate
+				bestCount = counts[candidate]
+			}
+		}
+	}
+	return best
+}
+
+type csvRowReader struct {
+	reader *csv.Reader
+	line   int
+}
+
+func (r *csvRowReader) Read() ([]string, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.line, _ = r.reader.FieldPos(0)
+	return row, nil
+}
+
+func (r *csvRowReader) RowNumber() int {
+	return r.line
+}
+
+type sliceRowReader struct {
+	records  [][]string
+	firstRow int
+	next     int
+}
+
+// NewSliceRowReader reads rows from memory. firstRow is the row number of
+// records[0] in the source file.
+func NewSliceRowReader(records [][]string, firstRow int) RowReader {
+	if firstRow < 1 {
+		firstRow = 1
+	}
+	return &sliceRowReader{records: records, firstRow: firstRow}
+}
+
+func (r *sliceRowReader) Read() ([]string, error) {
+	if r.next >= len(r.records) {
+		return nil, io.EOF
+	}
+	row := r.records[r.next]
+	r.next++
+	return row, nil
+}
+
+func (r *sliceRowReader) RowNumber() int {
+	return r.firstRow + r.next - 1
+}
+
+type bufferedRow struct {
+	cells  []string
+	number int
+}
+
+type headerRowReader struct {
+	rows     RowReader
+	buffered []bufferedRow
+	current  int
+}
+
+// SkipToHeaderRow positions rows so that the next Read returns the header row.
+// headerRow is 1-based; zero detects it from the first rows of the upload.
+func SkipToHeaderRow(rows RowReader, headerRow int) (RowReader, error) {
+	buffered := []bufferedRow{}
+	limit := headerScanRows
+	if headerRow > 0 {
+		limit = headerRow
+	}
+	for len(buffered) < limit {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		buffered = append(buffered, bufferedRow{cells: row, number: rows.RowNumber()})
+		if headerRow > 0 && rows.RowNumber() >= headerRow {
+			break
+		}
+	}
+
+	start := 0
+	if headerRow > 0 {
+		start = -1
+		for i, row := range buffered {
+			if row.number >= headerRow {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("header row %d is past the end of the file", headerRow)
+		}
+	} else {
+		records := make([][]string, len(buffered))
+		for i, row := range buffered {
+			records[i] = row.cells
+		}
+		start = DetectHeaderRow(records)
+	}
+
+	return &headerRowReader{rows: rows, buffered: buffered[start:]}, nil
+}
+
+func (r *headerRowReader) Read() ([]string, error) {
+	if len(r.buffered) > 0 {
+		row := r.buffered[0]
+		r.buffered = r.buffered[1:]
+		r.current = row.number
+		return row.cells, nil
+	}
+	row, err := r.rows.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.current = r.rows.RowNumber()
+	return row, nil
+}
+
+func (r *headerRowReader) RowNumber() int {
+	return r.current
+}
+
+type limitedRowReader struct {
+	rows  RowReader
+	limit int
+	count int
+}
+
+// LimitRows makes Read fail with ErrTooManyRows once more than limit rows
+// have been read. A limit of zero or less disables the check.
+func LimitRows(rows RowReader, limit int) RowReader {
+	if limit <= 0 {
+		return rows
+	}
+	return &limitedRowReader{rows: rows, limit: limit}
+}
+
+func (r *limitedRowReader) Read() ([]string, error) {
+	row, err := r.rows.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.count++
+	if r.count > r.limit {
+		return nil, fmt.Errorf("%w: more than %d rows", ErrTooManyRows, r.limit)
+	}
+	return row, nil
+}
+
+func (r *limitedRowReader) RowNumber() int {
+	return r.rows.RowNumber()
+}
+
+// ReadAllRows collects the remaining rows of a reader.
+func ReadAllRows(rows RowReader) ([][]string, error) {
+	records := [][]string{}
+	for {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, row)
+	}
+}
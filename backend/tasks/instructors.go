@@ -0,0 +1,390 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConflictDuplicateCode   = "duplicate_code"
+	ConflictUnmatchedCode   = "unmatched_code"
+	ConflictOverlappingTime = "overlapping_time"
+)
+
+type codeMatch int
+
+const (
+	matchNone codeMatch = iota
+	matchPrefix
+	matchRange
+	matchExact
+)
+
+// InstructorRule assigns an instructor to a code pattern: an exact code
+// ("1234"), an inclusive range ("1200-1210", "A1-A20") or a wildcard prefix
+// ("12*"). Bounds of a range without a letter prefix have as many digits as
+// each other; a pattern that is no valid range is an exact code.
+type InstructorRule struct {
+	Instructor string `json:"instructor"`
+	Pattern    string `json:"pattern"`
+
+	kind       codeMatch
+	prefix     string
+	rangeStart int
+	rangeEnd   int
+	rangeWidth int
+}
+
+type InstructorConflict struct {
+	Kind        string   `json:"kind"`
+	Instructors []string `json:"instructors"`
+	Codes       []string `json:"codes"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Message     string   `json:"message"`
+}
+
+// InstructorAssignment resolves class codes to instructors. When several
+// rules match a code, an exact code beats a range and a range beats a
+// wildcard; among equals the narrower range or longer prefix wins, then the
+// rule listed first.
+type InstructorAssignment struct {
+	rules []InstructorRule
+}
+
+// ParseInstructorAssignment builds an assignment from the parallel
+// instructor_names[] and instructor_codes[] form values, where each codes
+// entry is a comma-separated list of patterns.
+func ParseInstructorAssignment(names []string, codes []string) InstructorAssignment {
+	assignment := InstructorAssignment{}
+	for i, name := range names {
+		if strings.TrimSpace(name) == "" || i >= len(codes) {
+			continue
+		}
+		for _, pattern := range strings.Split(codes[i], ",") {
+			assignment.Assign(name, pattern)
+		}
+	}
+	return assignment
+}
+
+func (a *InstructorAssignment) Assign(instructor string, pattern string) {
+	instructor = strings.TrimSpace(instructor)
+	pattern = strings.TrimSpace(pattern)
+	if instructor == "" || pattern == "" {
+		return
+	}
+	a.rules = append(a.rules, parseInstructorRule(instructor, pattern))
+}
+
+func (a InstructorAssignment) Rules() []InstructorRule {
+	return append([]InstructorRule{}, a.rules...)
+}
+
+func (a InstructorAssignment) Empty() bool {
+	return len(a.rules) == 0
+}
+
+// Instructor returns the instructor assigned to code, or "" if no rule
+// matches.
+func (a InstructorAssignment) Instructor(code string) string {
+	if best := a.bestRules(code); len(best) > 0 {
+		return best[0].Instructor
+	}
+	return ""
+}
+
+// Conflicts reports codes claimed by more than one instructor, rules that
+// match none of the classes and instructors booked into overlapping classes.
+// rosters should already have their instructors resolved.
+func (a InstructorAssignment) Conflicts(rosters []ClassRoster) []InstructorConflict {
+	conflicts := []InstructorConflict{}
+
+	codes := []string{}
+	seenCodes := map[string]bool{}
+	for _, roster := range rosters {
+		code := strings.TrimSpace(roster.Code)
+		if code == "" || seenCodes[code] {
+			continue
+		}
+		seenCodes[code] = true
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	duplicates := map[string]*InstructorConflict{}
+	duplicateOrder := []string{}
+	matched := make([]bool, len(a.rules))
+	for _, code := range codes {
+		for i, rule := range a.rules {
+			if rule.match(code) != matchNone {
+				matched[i] = true
+			}
+		}
+
+		best := a.bestRules(code)
+		instructors := distinctInstructors(best)
+		if len(instructors) < 2 {
+			continue
+		}
+		patterns := []string{}
+		seenPatterns := map[string]bool{}
+		for _, rule := range best {
+			if !seenPatterns[rule.Pattern] {
+				seenPatterns[rule.Pattern] = true
+				patterns = append(patterns, rule.Pattern)
+			}
+		}
+		key := strings.ToLower(strings.Join(instructors, "\x00")) + "\x01" + strings.Join(patterns, "\x00")
+		if conflict, ok := duplicates[key]; ok {
+			conflict.Codes = append(conflict.Codes, code)
+			continue
+		}
+		duplicates[key] = &InstructorConflict{
+			Kind:        ConflictDuplicateCode,
+			Instructors: instructors,
+			Codes:       []string{code},
+			Pattern:     strings.Join(patterns, ", "),
+		}
+		duplicateOrder = append(duplicateOrder, key)
+	}
+	for _, key := range duplicateOrder {
+		conflict := duplicates[key]
+		conflict.Message = fmt.Sprintf("%s assigned to %s; using %s",
+			describeCodes(conflict.Codes), strings.Join(conflict.Instructors, " and "), conflict.Instructors[0])
+		conflicts = append(conflicts, *conflict)
+	}
+
+	if len(codes) > 0 {
+		for i, rule := range a.rules {
+			if matched[i] {
+				continue
+			}
+			conflicts = append(conflicts, InstructorConflict{
+				Kind:        ConflictUnmatchedCode,
+				Instructors: []string{rule.Instructor},
+				Codes:       []string{},
+				Pattern:     rule.Pattern,
+				Message:     fmt.Sprintf("%s for %s matches no class", rule.Pattern, rule.Instructor),
+			})
+		}
+	}
+
+	return append(conflicts, InstructorTimeConflicts(rosters)...)
+}
+
+// InstructorTimeConflicts reports pairs of classes taught by the same
+// instructor that meet on a common day at overlapping times.
+func InstructorTimeConflicts(rosters []ClassRoster) []InstructorConflict {
+	byInstructor := map[string][]ClassRoster{}
+	names := map[string]string{}
+	order := []string{}
+	seenCodes := map[string]bool{}
+	for _, roster := range rosters {
+		instructor := strings.TrimSpace(roster.Instructor)
+		code := strings.TrimSpace(roster.Code)
+		if instructor == "" || code == "" || seenCodes[code] {
+			continue
+		}
+		seenCodes[code] = true
+		key := strings.ToLower(instructor)
+		if _, ok := byInstructor[key]; !ok {
+			names[key] = instructor
+			order = append(order, key)
+		}
+		byInstructor[key] = append(byInstructor[key], roster)
+	}
+	sort.Strings(order)
+
+	conflicts := []InstructorConflict{}
+	for _, key := range order {
+		classes := byInstructor[key]
+		sort.SliceStable(classes, func(i, j int) bool {
+			return classes[i].Code < classes[j].Code
+		})
+		for i := 0; i < len(classes); i++ {
+			for j := i + 1; j < len(classes); j++ {
+				if !classesOverlap(classes[i], classes[j]) {
+					continue
+				}
+				conflicts = append(conflicts, InstructorConflict{
+					Kind:        ConflictOverlappingTime,
+					Instructors: []string{names[key]},
+					Codes:       []string{classes[i].Code, classes[j].Code},
+					Message: fmt.Sprintf("%s is assigned to %s (%s) and %s (%s) at overlapping times",
+						names[key], classes[i].Code, classes[i].Time, classes[j].Code, classes[j].Time),
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+func classesOverlap(a ClassRoster, b ClassRoster) bool {
+	first := a.ParsedSchedule()
+	second := b.ParsedSchedule()
+	if !first.HasTime || !second.HasTime {
+		return false
+	}
+	if first.StartMinutes >= second.EndMinutes || second.StartMinutes >= first.EndMinutes {
+		return false
+	}
+
+	firstDays := a.MeetingDays()
+	secondDays := b.MeetingDays()
+	if len(firstDays) > 0 && len(secondDays) > 0 && !sharesDay(firstDays, secondDays) {
+		return false
+	}
+
+	if first.FirstDate != "" && first.LastDate != "" && second.FirstDate != "" && second.LastDate != "" {
+		if first.LastDate < second.FirstDate || second.LastDate < first.FirstDate {
+			return false
+		}
+	}
+	return true
+}
+
+func sharesDay(a []string, b []string) bool {
+	for _, day := range a {
+		for _, other := range b {
+			if day == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseInstructorRule(instructor string, pattern string) InstructorRule {
+	rule := InstructorRule{Instructor: instructor, Pattern: pattern, kind: matchExact}
+	if strings.HasSuffix(pattern, "*") {
+		rule.kind = matchPrefix
+		rule.prefix = strings.TrimRight(pattern, "*")
+		return rule
+	}
+
+	normalized := strings.NewReplacer("–", "-", "—", "-").Replace(pattern)
+	parts := strings.Split(normalized, "-")
+	if len(parts) != 2 {
+		return rule
+	}
+	startPrefix, start, startDigits, ok := splitCodeNumber(strings.TrimSpace(parts[0]))
+	if !ok {
+		return rule
+	}
+	endPrefix, end, endDigits, ok := splitCodeNumber(strings.TrimSpace(parts[1]))
+	if !ok {
+		return rule
+	}
+	if endPrefix == "" {
+		endPrefix = startPrefix
+	}
+	if !strings.EqualFold(startPrefix, endPrefix) || end < start {
+		return rule
+	}
+	// Codes such as "12345-01" hold a dash without being ranges.
+	if startPrefix == "" && startDigits != endDigits {
+		return rule
+	}
+	rule.kind = matchRange
+	rule.prefix = startPrefix
+	rule.rangeStart = start
+	rule.rangeEnd = end
+	rule.rangeWidth = end - start
+	return rule
+}
+
+// splitCodeNumber splits a code such as "A120" into its prefix and trailing
+// number, and counts the number's digits.
+func splitCodeNumber(code string) (string, int, int, bool) {
+	i := len(code)
+	for i > 0 && code[i-1] >= '0' && code[i-1] <= '9' {
+		i--
+	}
+	if i == len(code) {
+		return "", 0, 0, false
+	}
+	number, err := strconv.Atoi(code[i:])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	return code[:i], number, len(code) - i, true
+}
+
+func (rule InstructorRule) match(code string) codeMatch {
+	if strings.EqualFold(code, rule.Pattern) {
+		return matchExact
+	}
+	switch rule.kind {
+	case matchPrefix:
+		if strings.HasPrefix(strings.ToLower(code), strings.ToLower(rule.prefix)) {
+			return matchPrefix
+		}
+	case matchRange:
+		prefix, number, _, ok := splitCodeNumber(code)
+		if ok && strings.EqualFold(prefix, rule.prefix) && number >= rule.rangeStart && number <= rule.rangeEnd {
+			return matchRange
+		}
+	}
+	return matchNone
+}
+
+// moreSpecific reports whether rule a should win over rule b for a code both
+// match.
+func (rule InstructorRule) moreSpecific(other InstructorRule) bool {
+	if rule.kind != other.kind {
+		return rule.kind > other.kind
+	}
+	switch rule.kind {
+	case matchPrefix:
+		return len(rule.prefix) > len(other.prefix)
+	case matchRange:
+		return rule.rangeWidth < other.rangeWidth
+	}
+	return false
+}
+
+// bestRules returns the most specific rules matching code, in listed order.
+func (a InstructorAssignment) bestRules(code string) []InstructorRule {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil
+	}
+	best := []InstructorRule{}
+	for _, rule := range a.rules {
+		if rule.match(code) == matchNone {
+			continue
+		}
+		switch {
+		case len(best) == 0:
+			best = append(best, rule)
+		case rule.moreSpecific(best[0]):
+			best = []InstructorRule{rule}
+		case !best[0].moreSpecific(rule):
+			best = append(best, rule)
+		}
+	}
+	return best
+}
+
+func distinctInstructors(rules []InstructorRule) []string {
+	instructors := []string{}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		key := strings.ToLower(rule.Instructor)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		instructors = append(instructors, rule.Instructor)
+	}
+	return instructors
+}
+
+func describeCodes(codes []string) string {
+	if len(codes) == 1 {
+		return "Code " + codes[0]
+	}
+	return "Codes " + strings.Join(codes, ", ")
+}
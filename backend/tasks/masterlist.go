@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,217 +18,443 @@ type FormatOptions struct {
 	BoldTime          bool
 	CenterCourse      bool
 	BoldCourse        bool
+	NameDisplay       NameDisplay
+	// Student details are sensitive and only printed when asked for.
+	ShowAge           bool
+	ShowGuardian      bool
+	ShowMedicalAlerts bool
+	SessionStart      time.Time
+	SortOrder         SortOrder
+	// FallbackDay is the day of classes in an export with no Day column.
+	FallbackDay string
+	Layout      WorkbookLayout
+	// Columns overrides the default columns when set; see ResolveColumns.
+	Columns []ColumnSpec
+
+	// Print setup for each masterlist sheet.
+	FreezeHeader bool
+	AutoFilter   bool
+	Orientation  PageOrientation
+	FitToWidth   bool
+	RepeatHeader bool
+	PageBreaks   PageBreakMode
+	HeaderFooter bool
+	SessionName  string
+	// PDFPage is the paper, margins and text size of the PDF, whose running
+	// header and page numbers are also turned on by HeaderFooter.
+	PDFPage PDFPageSetup
+	// PDFRenderer picks Chrome or the native renderer for PDFs.
+	PDFRenderer PDFRenderer
+	// KeepClassTogether moves a class that would split across PDF pages to
+	// the next page, and ContinuedHeaders repeats its time and course
+	// headers, marked "(cont.)", on the pages a class or time block spans.
+	KeepClassTogether bool
+	ContinuedHeaders  bool
+
+	// ShowCapacity adds enrollment and capacity to course headers, and
+	// HighlightEnrollment fills those of under-enrolled classes.
+	ShowCapacity        bool
+	HighlightEnrollment bool
+
+	// Summary rows counting the students of each class, time block, level
+	// and instructor, and in total. ShowClassCount adds the number of
+	// students to course headers.
+	ClassTotals      bool
+	TimeTotals       bool
+	LevelTotals      bool
+	InstructorTotals bool
+	GrandTotal       bool
+	ShowClassCount   bool
 }
 
 type MasterListResult struct {
-	Filename string
-	Data     []byte
+	Filename  string
+	Data      []byte
+	Conflicts []InstructorConflict
 }
 
-func ProcessMasterList(records [][]string, options FormatOptions, instructorMap map[string]string) (MasterListResult, error) {
-	if len(records) < 2 {
-		return MasterListResult{}, fmt.Errorf("no rows to process")
+func ProcessMasterList(records [][]string, options FormatOptions, instructors InstructorAssignment) (MasterListResult, error) {
+	classes, options, err := MasterListClasses(records, options, instructors)
+	if err != nil {
+		return MasterListResult{}, err
 	}
+	data, err := WriteMasterListWorkbook(classes.Classes, options)
+	if err != nil {
+		return MasterListResult{}, err
+	}
+	return MasterListResult{
+		Filename:  MasterListFilename(MasterListXLSX),
+		Data:      data,
+		Conflicts: classes.Conflicts,
+	}, nil
+}
 
-	headers := records[0]
-	columnIndex := map[string]int{}
-	for i, header := range headers {
-		columnIndex[header] = i
+// MasterListClasses groups an export's rows into classes for a masterlist.
+// When options choose no columns, the returned options carry the original
+// columns labelled with the export's own column names, except in the
+// instructor layout, which has columns of its own.
+func MasterListClasses(records [][]string, options FormatOptions, instructors InstructorAssignment) (CSVResult, FormatOptions, error) {
+	if len(records) < 2 {
+		return CSVResult{}, options, ErrNoRows
+	}
+	result, err := ProcessCSV(records, CSVOptions{
+		FallbackDay:  options.FallbackDay,
+		NameDisplay:  options.NameDisplay,
+		SessionStart: options.SessionStart,
+		SortOrder:    options.SortOrder,
+	}, instructors)
+	if err != nil {
+		return result, options, err
 	}
 
-	getColumn := func(row []string, name string) string {
-		idx, ok := columnIndex[name]
-		if !ok || idx >= len(row) {
-			return ""
+	if len(options.Columns) == 0 && options.Layout != LayoutByInstructor {
+		isSeries := false
+		for _, header := range records[0] {
+			if strings.TrimPrefix(strings.TrimSpace(header), "\uFEFF") == "ServiceName" {
+				isSeries = true
+			}
 		}
-		return row[idx]
+		options.Columns = DefaultMasterListColumns(isSeries, options)
 	}
+	return result, options, nil
+}
 
-	_, isSeries := columnIndex["ServiceName"]
+// WriteMasterListWorkbook lays rosters out as a masterlist workbook, on one
+// sheet or in the multi-sheet or instructor layout chosen in options.
+func WriteMasterListWorkbook(rosters []ClassRoster, options FormatOptions) ([]byte, error) {
+	sections, err := MasterListSections(rosters, options)
+	if err != nil {
+		return nil, err
+	}
 
-	outputHeaders := []string{"EventID", "EventTime", "Instructor"}
-	if isSeries {
-		outputHeaders = append(outputHeaders, "ServiceName", "AttendeeName", "AttendeePhone")
-	} else {
-		outputHeaders = append(outputHeaders, "Service", "AttendeeName", "Phone")
+	file := excelize.NewFile()
+	switch options.Layout {
+	case LayoutMultiSheet:
+		err = writeMultiSheetWorkbook(file, rosters, options)
+	case LayoutByInstructor:
+		err = writeInstructorSheets(file, sections, options)
+	default:
+		_, err = writeMasterListSheet(file, file.GetSheetName(0), sections[0].List, options)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	outputRows := [][]string{}
-	for i := 1; i < len(records); i++ {
-		row := records[i]
-		if len(row) == 0 {
-			continue
+	buffer, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeMasterListSheet streams the column headers and rows of list to sheet
+// in a single pass, with the styles chosen in options. It returns the first
+// row of each class block: its course header when there is one, otherwise
+// its first student.
+func writeMasterListSheet(file *excelize.File, sheet string, list MasterList, options FormatOptions) (map[string]int, error) {
+	columns := list.Columns
+	styles, err := newMasterListStyles(file, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := setMasterListPrintSetup(file, sheet, len(columns), len(list.Rows)+1, options); err != nil {
+		return nil, err
+	}
+
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	if options.FreezeHeader {
+		err := stream.SetPanes(&excelize.Panes{
+			Freeze:      true,
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range pageBreakRows(list.Rows, 2, options.PageBreaks) {
+		if err := stream.InsertPageBreak(fmt.Sprintf("A%d", row)); err != nil {
+			return nil, err
+		}
+	}
+	for col, width := range masterListColumnWidths(list) {
+		if err := stream.SetColWidth(col+1, col+1, width); err != nil {
+			return nil, err
 		}
+	}
+
+	if err := stream.SetRow("A1", styledCells(list.Labels(), len(columns), styles.cell)); err != nil {
+		return nil, err
+	}
 
-		eventID := getColumn(row, "EventID")
-		eventTime := getColumn(row, "EventTime")
-		instructor := instructorMap[eventID]
+	lastCell, _ := excelize.ColumnNumberToName(len(columns))
+	counter := newStudentCounter(list, 2)
+	blocks := map[string]int{}
+	for i, line := range list.Rows {
+		row := i + 2
+		cell := fmt.Sprintf("A%d", row)
+		if _, ok := blocks[line.Code]; !ok && (line.Kind == MasterListStudentRow || line.Kind == MasterListCourseHeader) {
+			blocks[line.Code] = row
+		}
+		switch line.Kind {
+		case MasterListStudentRow:
+			if err := stream.SetRow(cell, styledCells(line.Cells, len(columns), styles.cell)); err != nil {
+				return nil, err
+			}
+			continue
+		case MasterListTotalRow:
+			cells := styledCells([]string{line.Label}, len(columns), styles.total)
+			count := excelize.Cell{StyleID: styles.total, Value: line.Count, Formula: counter.formula(line.Classes)}
+			if len(cells) > 1 {
+				cells[len(cells)-1] = count
+			} else {
+				cells = append(cells, count)
+			}
+			if err := stream.SetRow(cell, cells); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-		if isSeries {
-			outputRows = append(outputRows, []string{
-				eventID,
-				eventTime,
-				instructor,
-				getColumn(row, "ServiceName"),
-				getColumn(row, "AttendeeName"),
-				getColumn(row, "AttendeePhone"),
-			})
-		} else {
-			outputRows = append(outputRows, []string{
-				eventID,
-				eventTime,
-				instructor,
-				getColumn(row, "Service"),
-				getColumn(row, "AttendeeName"),
-				getColumn(row, "Phone"),
-			})
+		style, center := styles.timeHeader, options.CenterTime
+		if line.Kind == MasterListCourseHeader {
+			style, center = styles.courseHeader, options.CenterCourse
+			if options.HighlightEnrollment {
+				switch line.Enrollment {
+				case EnrollmentSingle:
+					style = styles.courseSingle
+				case EnrollmentLow:
+					style = styles.courseLow
+				}
+			}
+		}
+		if err := stream.SetRow(cell, styledCells([]string{line.Label}, len(columns), style)); err != nil {
+			return nil, err
+		}
+		if center && len(columns) > 1 {
+			if err := stream.MergeCell(cell, fmt.Sprintf("%s%d", lastCell, row)); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	file := excelize.NewFile()
-	sheet := file.GetSheetName(0)
+	return blocks, stream.Flush()
+}
+
+// maxFormulaLength is Excel's limit on the length of a formula.
+const maxFormulaLength = 8192
+
+// studentCounter writes the formulas of total rows, which count the student
+// rows of the classes they total so the counts follow edits to the sheet.
+type studentCounter struct {
+	// column is the student name column, counted with COUNTA; without one
+	// the rows are counted with ROWS.
+	column string
+	counta bool
+	// ranges holds the first and last sheet row of each class's students.
+	ranges map[string][][2]int
+	// headers marks the sheet rows of header rows, which only fill the first
+	// column, so ranges on either side of them can be counted as one.
+	headers map[int]bool
+}
 
-	for colIndex, header := range outputHeaders {
-		cell, _ := excelize.CoordinatesToCellName(colIndex+1, 1)
-		file.SetCellValue(sheet, cell, header)
+func newStudentCounter(list MasterList, firstRow int) studentCounter {
+	counter := studentCounter{column: "A", ranges: map[string][][2]int{}, headers: map[int]bool{}}
+	for i, spec := range list.Columns {
+		if spec.Column == ColumnName {
+			counter.column, _ = excelize.ColumnNumberToName(i + 1)
+			counter.counta = true
+			break
+		}
+	}
+	for i, line := range list.Rows {
+		row := firstRow + i
+		switch line.Kind {
+		case MasterListStudentRow:
+			ranges := counter.ranges[line.Code]
+			if n := len(ranges); n > 0 && ranges[n-1][1] == row-1 {
+				ranges[n-1][1] = row
+			} else {
+				ranges = append(ranges, [2]int{row, row})
+			}
+			counter.ranges[line.Code] = ranges
+		case MasterListTimeHeader, MasterListCourseHeader:
+			counter.headers[row] = true
+		}
 	}
+	return counter
+}
 
-	for rowIndex, row := range outputRows {
-		for colIndex, value := range row {
-			cell, _ := excelize.CoordinatesToCellName(colIndex+1, rowIndex+2)
-			file.SetCellValue(sheet, cell, value)
+// formula counts the students of classes, or returns "" when the formula
+// would be too long for Excel and the row keeps its computed count.
+func (c studentCounter) formula(classes []string) string {
+	ranges := [][2]int{}
+	for _, code := range classes {
+		ranges = append(ranges, c.ranges[code]...)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	joined := [][2]int{}
+	for _, next := range ranges {
+		if n := len(joined); n > 0 && c.joins(joined[n-1][1], next[0]) {
+			joined[n-1][1] = next[1]
+			continue
 		}
+		joined = append(joined, next)
 	}
 
-	if options.TimeHeaders {
-		addTimeHeaders(file, sheet, 2, len(outputRows)+1)
+	function := "ROWS"
+	if c.counta {
+		function = "COUNTA"
 	}
-	if options.CourseHeaders {
-		addCourseHeaders(file, sheet, 2, len(outputRows)+1)
+	terms := make([]string, len(joined))
+	for i, r := range joined {
+		terms[i] = fmt.Sprintf("%s(%s%d:%s%d)", function, c.column, r[0], c.column, r[1])
 	}
-	if options.InstructorHeaders {
-		addInstructorHeaders(file, sheet, 2, len(outputRows)+1)
+	formula := strings.Join(terms, "+")
+	if formula == "" || len(formula) > maxFormulaLength {
+		return ""
 	}
+	return formula
+}
 
-	rows, _ := file.GetRows(sheet)
-	lastRow := len(rows)
-	if options.BoldTime || options.BoldCourse || options.CenterTime || options.CenterCourse {
-		applyHeaderStyles(file, sheet, 2, lastRow, options)
+// joins reports whether the student rows ending at last and starting at next
+// can be counted as one range: only header rows lie between them, and they
+// are counted by name in a column the headers leave empty.
+func (c studentCounter) joins(last int, next int) bool {
+	if !c.counta || c.column == "A" {
+		return next == last+1
 	}
-
-	if options.Borders {
-		applyBorders(file, sheet, 1, lastRow, len(outputHeaders))
+	for row := last + 1; row < next; row++ {
+		if !c.headers[row] {
+			return false
+		}
 	}
+	return true
+}
 
-	autoSizeColumns(file, sheet, len(outputHeaders), lastRow)
+// masterListStyles are the style IDs for each kind of masterlist row, with
+// borders already folded in when they are on.
+type masterListStyles struct {
+	cell         int
+	timeHeader   int
+	courseHeader int
+	// courseSingle and courseLow fill the course headers of under-enrolled
+	// classes.
+	courseSingle int
+	courseLow    int
+	total        int
+}
 
-	buffer, err := file.WriteToBuffer()
-	if err != nil {
-		return MasterListResult{}, err
+func newMasterListStyles(file *excelize.File, options FormatOptions) (masterListStyles, error) {
+	var border []excelize.Border
+	if options.Borders {
+		border = cellBorders
+	}
+	newStyle := func(bold bool, center bool, fill string, color string) (int, error) {
+		if !bold && !center && fill == "" && border == nil {
+			return 0, nil
+		}
+		style := &excelize.Style{Border: border}
+		if bold || color != "" {
+			style.Font = &excelize.Font{Bold: bold, Color: color}
+		}
+		if fill != "" {
+			style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{fill}}
+		}
+		if center {
+			style.Alignment = &excelize.Alignment{Horizontal: "center", Vertical: "center"}
+		}
+		return file.NewStyle(style)
 	}
 
-	now := time.Now()
-	filename := fmt.Sprintf("MasterList_%d_%d_%d.xlsx", now.Month(), now.Day(), now.Year())
-	return MasterListResult{
-		Filename: filename,
-		Data:     buffer.Bytes(),
-	}, nil
+	var styles masterListStyles
+	var err error
+	if styles.cell, err = newStyle(false, false, "", ""); err != nil {
+		return styles, err
+	}
+	if styles.timeHeader, err = newStyle(options.BoldTime, options.CenterTime, "", ""); err != nil {
+		return styles, err
+	}
+	if styles.courseHeader, err = newStyle(options.BoldCourse, options.CenterCourse, "", ""); err != nil {
+		return styles, err
+	}
+	if styles.courseSingle, err = newStyle(options.BoldCourse, options.CenterCourse, singleEnrollmentFill, "FFFFFF"); err != nil {
+		return styles, err
+	}
+	if styles.courseLow, err = newStyle(options.BoldCourse, options.CenterCourse, lowEnrollmentFill, ""); err != nil {
+		return styles, err
+	}
+	styles.total, err = newStyle(true, false, totalFill, "")
+	return styles, err
 }
 
-func addTimeHeaders(file *excelize.File, sheet string, startRow int, endRow int) {
-	previous := ""
-	row := startRow
-	for row <= endRow {
-		timeValue, _ := file.GetCellValue(sheet, fmt.Sprintf("B%d", row))
-		if timeValue != previous {
-			file.InsertRows(sheet, row, 1)
-			file.SetCellValue(sheet, fmt.Sprintf("A%d", row), timeValue)
-			previous = timeValue
-			endRow++
-			row++
-		}
-		previous = timeValue
-		row++
-	}
-}
-
-func addCourseHeaders(file *excelize.File, sheet string, startRow int, endRow int) {
-	previous := ""
-	row := startRow
-	for row <= endRow {
-		courseValue, _ := file.GetCellValue(sheet, fmt.Sprintf("A%d", row))
-		timeValue, _ := file.GetCellValue(sheet, fmt.Sprintf("B%d", row))
-		serviceName, _ := file.GetCellValue(sheet, fmt.Sprintf("D%d", row))
-		if courseValue != previous && timeValue != "" {
-			file.InsertRows(sheet, row, 1)
-			file.SetCellValue(sheet, fmt.Sprintf("A%d", row), serviceName)
-			previous = courseValue
-			endRow++
-			row++
-		}
-		previous = courseValue
-		row++
-	}
-}
-
-func addInstructorHeaders(file *excelize.File, sheet string, startRow int, endRow int) {
-	for row := startRow; row < endRow; row++ {
-		timeValue, _ := file.GetCellValue(sheet, fmt.Sprintf("B%d", row))
-		headerValue, _ := file.GetCellValue(sheet, fmt.Sprintf("A%d", row))
-		if timeValue == "" && !strings.Contains(headerValue, ":") {
-			instructorValue, _ := file.GetCellValue(sheet, fmt.Sprintf("C%d", row+1))
-			if instructorValue != "" {
-				file.SetCellValue(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("%s - %s", headerValue, instructorValue))
-			}
+// styledCells pads values to width cells that all carry style, so borders
+// and merged headers cover every column.
+func styledCells(values []string, width int, style int) []interface{} {
+	if width < len(values) {
+		width = len(values)
+	}
+	cells := make([]interface{}, width)
+	for i := range cells {
+		cell := excelize.Cell{StyleID: style}
+		if i < len(values) {
+			cell.Value = values[i]
 		}
+		cells[i] = cell
 	}
+	return cells
 }
 
-func applyHeaderStyles(file *excelize.File, sheet string, startRow int, endRow int, options FormatOptions) {
-	boldStyle, _ := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
-	centerStyle, _ := file.NewStyle(&excelize.Style{Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"}})
-
-	for row := startRow; row <= endRow; row++ {
-		timeValue, _ := file.GetCellValue(sheet, fmt.Sprintf("B%d", row))
-		headerValue, _ := file.GetCellValue(sheet, fmt.Sprintf("A%d", row))
-		if timeValue != "" {
-			continue
+// masterListColumnWidths sizes each column to its longest value, header rows
+// included, with the same minimum autoSizeColumns uses.
+func masterListColumnWidths(list MasterList) []float64 {
+	lengths := make([]int, len(list.Columns))
+	measure := func(col int, value string) {
+		if col < len(lengths) && len(value) > lengths[col] {
+			lengths[col] = len(value)
 		}
-
-		isTimeHeader := strings.Contains(headerValue, ":")
-		if isTimeHeader && options.BoldTime {
-			file.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("A%d", row), boldStyle)
+	}
+	for i, label := range list.Labels() {
+		measure(i, label)
+	}
+	for _, row := range list.Rows {
+		if row.Kind != MasterListStudentRow {
+			measure(0, row.Label)
+			continue
 		}
-		if !isTimeHeader && options.BoldCourse {
-			file.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("A%d", row), boldStyle)
+		for i, cell := range row.Cells {
+			measure(i, cell)
 		}
+	}
 
-		if isTimeHeader && options.CenterTime {
-			file.MergeCell(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("G%d", row))
-			file.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("G%d", row), centerStyle)
-		}
-		if !isTimeHeader && options.CenterCourse {
-			file.MergeCell(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("G%d", row))
-			file.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("G%d", row), centerStyle)
+	widths := make([]float64, len(list.Columns))
+	for i, length := range lengths {
+		if length < 10 {
+			length = 10
 		}
+		widths[i] = float64(length + 2)
 	}
+	return widths
 }
 
-func applyBorders(file *excelize.File, sheet string, startRow int, endRow int, columns int) {
-	borderStyle, _ := file.NewStyle(&excelize.Style{
-		Border: []excelize.Border{
-			{Type: "left", Color: "000000", Style: 1},
-			{Type: "right", Color: "000000", Style: 1},
-			{Type: "top", Color: "000000", Style: 1},
-			{Type: "bottom", Color: "000000", Style: 1},
-		},
-	})
+// Fill colours for the course headers of classes with a single swimmer and
+// classes less than half full, and for total rows.
+const (
+	singleEnrollmentFill = "F43F5E"
+	lowEnrollmentFill    = "F59E0B"
+	totalFill            = "E5E7EB"
+)
 
-	for row := startRow; row <= endRow; row++ {
-		startCell, _ := excelize.CoordinatesToCellName(1, row)
-		endCell, _ := excelize.CoordinatesToCellName(columns, row)
-		file.SetCellStyle(sheet, startCell, endCell, borderStyle)
-	}
+var cellBorders = []excelize.Border{
+	{Type: "left", Color: "000000", Style: 1},
+	{Type: "right", Color: "000000", Style: 1},
+	{Type: "top", Color: "000000", Style: 1},
+	{Type: "bottom", Color: "000000", Style: 1},
 }
 
 func autoSizeColumns(file *excelize.File, sheet string, columns int, endRow int) {
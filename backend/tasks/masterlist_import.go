@@ -0,0 +1,470 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrNotMasterList = errors.New("workbook is not a masterlist")
+
+// capacitySuffixPattern matches the " — 5/7" CapacityLabel and the
+// " (5 students)" ClassCountLabel add to course headers.
+var capacitySuffixPattern = regexp.MustCompile(`(\s+—\s+\d+/\d+|\s+\(\d+ students?\))$`)
+
+// masterListHeaderColumns maps the column labels a masterlist may carry,
+// normalized, to their columns. It covers the default labels, the original
+// export names and the column names themselves.
+var masterListHeaderColumns = func() map[string]MasterListColumn {
+	columns := map[string]MasterListColumn{
+		"eventid":       ColumnCode,
+		"eventtime":     ColumnTime,
+		"servicename":   ColumnLevel,
+		"service":       ColumnLevel,
+		"attendeename":  ColumnName,
+		"attendeephone": ColumnPhone,
+	}
+	for _, spec := range masterListColumns {
+		columns[normalizeHeader(spec.Label)] = spec.Column
+		columns[normalizeHeader(string(spec.Column))] = spec.Column
+	}
+	return columns
+}()
+
+// MasterListImport is a masterlist workbook read back into class rosters.
+type MasterListImport struct {
+	Classes     []ClassRoster   `json:"classes"`
+	Sheets      []string        `json:"sheets"`
+	Diagnostics []RowDiagnostic `json:"diagnostics"`
+}
+
+// importRow is one student row of a masterlist sheet with the header rows
+// above it applied.
+type importRow struct {
+	row    int
+	values map[MasterListColumn]string
+	block  int
+}
+
+// importBlock is the run of students under one course header.
+type importBlock struct {
+	label      string
+	time       string
+	level      string
+	instructor string
+	code       string
+}
+
+// ImportMasterList reads a workbook written by ProcessMasterList, including
+// edits made by hand, back into class rosters. Students moved under another
+// course header join that class. In a multi-sheet workbook the day sheets are
+// read and the summary and instructor sheets are skipped; a class on several
+// day sheets is taken from the first.
+func ImportMasterList(reader io.Reader) (MasterListImport, error) {
+	file, err := excelize.OpenReader(reader)
+	if err != nil {
+		return MasterListImport{}, fmt.Errorf("open workbook: %w", err)
+	}
+	defer file.Close()
+
+	sheets := masterListSheets(file)
+	result := MasterListImport{Sheets: sheets, Diagnostics: []RowDiagnostic{}}
+	rosters := map[string]*ClassRoster{}
+	order := []string{}
+	for _, sheet := range sheets {
+		rows, err := file.GetRows(sheet)
+		if err != nil {
+			return MasterListImport{}, fmt.Errorf("read sheet %q: %w", sheet, err)
+		}
+		classes, diagnostics, err := importMasterListSheet(sheet, rows, totalRows(file, sheet, rows), len(sheets) > 1)
+		if err != nil {
+			return MasterListImport{}, err
+		}
+		result.Diagnostics = append(result.Diagnostics, diagnostics...)
+		for i := range classes {
+			code := classes[i].Code
+			if _, ok := rosters[code]; ok {
+				continue
+			}
+			rosters[code] = &classes[i]
+			order = append(order, code)
+		}
+	}
+
+	result.Classes = make([]ClassRoster, 0, len(order))
+	for _, code := range order {
+		result.Classes = append(result.Classes, *rosters[code])
+	}
+	if len(result.Classes) == 0 {
+		return result, ErrNoStudents
+	}
+	return result, nil
+}
+
+// masterListSheets picks the sheets holding the masterlist: the day sheets
+// of a multi-sheet workbook, otherwise the active sheet.
+func masterListSheets(file *excelize.File) []string {
+	sheets := file.GetSheetList()
+	hasSummary := false
+	for _, sheet := range sheets {
+		hasSummary = hasSummary || strings.EqualFold(sheet, summarySheetName)
+	}
+	if hasSummary {
+		dayNames := map[string]bool{strings.ToLower(noDaySheetName): true}
+		for _, code := range weekdayOrder {
+			dayNames[strings.ToLower(DayName(code))] = true
+		}
+		days := []string{}
+		for _, sheet := range sheets {
+			if dayNames[strings.ToLower(sheet)] {
+				days = append(days, sheet)
+			}
+		}
+		if len(days) > 0 {
+			return days
+		}
+	}
+	if active := file.GetActiveSheetIndex(); active >= 0 && active < len(sheets) {
+		return []string{sheets[active]}
+	}
+	return sheets[:1]
+}
+
+// totalRows finds the total rows of a sheet, the only rows written with
+// formulas, by their row index.
+func totalRows(file *excelize.File, sheet string, rows [][]string) map[int]bool {
+	totals := map[int]bool{}
+	for i := 1; i < len(rows); i++ {
+		for j, value := range rows[i] {
+			if value == "" {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if formula, _ := file.GetCellFormula(sheet, cell); formula != "" {
+				totals[i] = true
+				break
+			}
+		}
+	}
+	return totals
+}
+
+func importMasterListSheet(sheet string, rows [][]string, totals map[int]bool, multiSheet bool) ([]ClassRoster, []RowDiagnostic, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	columns := map[MasterListColumn]int{}
+	for i, label := range rows[0] {
+		if column, ok := masterListHeaderColumns[normalizeHeader(label)]; ok {
+			if _, seen := columns[column]; !seen {
+				columns[column] = i
+			}
+		}
+	}
+	nameIndex, ok := columns[ColumnName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: sheet %q has no student name column", ErrNotMasterList, sheet)
+	}
+
+	diagnostics := []RowDiagnostic{}
+	report := func(row int, column MasterListColumn, severity Severity, action RowAction, reason string, value string, code string) {
+		if multiSheet {
+			reason = fmt.Sprintf("%s on sheet %q", reason, sheet)
+		}
+		diagnostics = append(diagnostics, RowDiagnostic{
+			Row: row, Column: string(column), Severity: severity, Action: action,
+			Reason: reason, Value: value, Code: code,
+		})
+	}
+
+	blocks := []importBlock{}
+	students := []importRow{}
+	currentTime := ""
+	for i := 1; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) || totals[i] {
+			continue
+		}
+		values := map[MasterListColumn]string{}
+		for column, index := range columns {
+			if index < len(row) {
+				values[column] = strings.TrimSpace(row[index])
+			}
+		}
+
+		if label, ok := masterListHeaderLabel(row, nameIndex); ok {
+			if _, _, isTime := parseTimeRange(label); isTime || label == nextStudentTime(rows[i+1:], columns, nameIndex) {
+				currentTime = label
+				continue
+			}
+			blocks = append(blocks, importBlock{label: label, time: currentTime})
+			continue
+		}
+
+		if values[ColumnName] == "" {
+			report(i+1, ColumnName, SeverityWarning, RowDropped, "no student name", "", values[ColumnCode])
+			continue
+		}
+		if values[ColumnTime] == "" {
+			values[ColumnTime] = currentTime
+		}
+		student := importRow{row: i + 1, values: values, block: len(blocks) - 1}
+		if student.block >= 0 && blocks[student.block].time != currentTime {
+			student.block = -1
+		}
+		students = append(students, student)
+	}
+
+	resolveImportBlocks(blocks, students)
+	blockCodes := map[string]bool{}
+	for _, block := range blocks {
+		blockCodes[block.code] = true
+	}
+
+	rosters := map[string]*ClassRoster{}
+	order := []string{}
+	for _, student := range students {
+		code := student.values[ColumnCode]
+		var block *importBlock
+		if student.block >= 0 {
+			block = &blocks[student.block]
+			if block.code != "" && code != "" && code != block.code && !blockCodes[code] {
+				// No header carries this class any more, so the row is its
+				// class rather than a student moved out of one; keep it.
+				report(student.row, ColumnCode, SeverityWarning, RowImported,
+					fmt.Sprintf("kept in class %s although listed under %q, class %s", code, block.label, block.code), code, code)
+				block = nil
+			} else if block.code != "" && code != block.code {
+				if code != "" {
+					report(student.row, ColumnCode, SeverityWarning, RowImported,
+						fmt.Sprintf("moved to class %s under %q", block.code, block.label), code, block.code)
+				}
+				code = block.code
+				// The moved row still carries its old class's cells.
+				for _, column := range []MasterListColumn{ColumnTime, ColumnLevel, ColumnInstructor, ColumnLocation, ColumnSchedule, ColumnDay} {
+					delete(student.values, column)
+				}
+			}
+		}
+		if code == "" {
+			code = strings.Join([]string{student.values[ColumnTime], student.values[ColumnLevel], student.values[ColumnInstructor]}, " ")
+			code = strings.TrimSpace(code)
+		}
+
+		roster, ok := rosters[code]
+		if !ok {
+			roster = &ClassRoster{Code: code, Students: []RosterStudent{}}
+			rosters[code] = roster
+			order = append(order, code)
+		}
+		fillImportedClass(roster, student.values, block)
+		roster.Students = append(roster.Students, importedStudent(student.values))
+	}
+
+	classes := make([]ClassRoster, 0, len(order))
+	for _, code := range order {
+		classes = append(classes, *rosters[code])
+	}
+	return classes, diagnostics, nil
+}
+
+// masterListHeaderLabel reports whether row is a time or course header: only
+// column A is filled. When the names are in column A such rows are read as
+// students instead.
+func masterListHeaderLabel(row []string, nameIndex int) (string, bool) {
+	if nameIndex == 0 || len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+		return "", false
+	}
+	for _, cell := range row[1:] {
+		if strings.TrimSpace(cell) != "" {
+			return "", false
+		}
+	}
+	return strings.TrimSpace(row[0]), true
+}
+
+func nextStudentTime(rows [][]string, columns map[MasterListColumn]int, nameIndex int) string {
+	index, ok := columns[ColumnTime]
+	if !ok {
+		return ""
+	}
+	for _, row := range rows {
+		if _, isHeader := masterListHeaderLabel(row, nameIndex); isHeader || isBlankRow(row) {
+			continue
+		}
+		if index < len(row) {
+			return strings.TrimSpace(row[index])
+		}
+		return ""
+	}
+	return ""
+}
+
+// resolveImportBlocks works out the class, level and instructor of each
+// course header block. The class is the code most of its students carry; on a
+// tie, the code whose students' level matches the header, then the code of
+// the first student. The header text is "Level", "Level - Instructor", either
+// with a capacity suffix.
+func resolveImportBlocks(blocks []importBlock, students []importRow) {
+	type blockCode struct {
+		count        int
+		levelMatches int
+		first        int
+		level        string
+	}
+	codes := make([]map[string]*blockCode, len(blocks))
+	firstLevel := make([]string, len(blocks))
+	for i, student := range students {
+		if student.block < 0 {
+			continue
+		}
+		if codes[student.block] == nil {
+			codes[student.block] = map[string]*blockCode{}
+			firstLevel[student.block] = student.values[ColumnLevel]
+		}
+		code := student.values[ColumnCode]
+		if code == "" {
+			continue
+		}
+		entry, ok := codes[student.block][code]
+		if !ok {
+			entry = &blockCode{first: i, level: student.values[ColumnLevel]}
+			codes[student.block][code] = entry
+		}
+		entry.count++
+		if headerHasLevel(blocks[student.block].label, student.values[ColumnLevel]) {
+			entry.levelMatches++
+		}
+	}
+
+	for i := range blocks {
+		block := &blocks[i]
+		var best *blockCode
+		for code, entry := range codes[i] {
+			if best == nil || entry.count > best.count ||
+				(entry.count == best.count && (entry.levelMatches > best.levelMatches ||
+					(entry.levelMatches == best.levelMatches && entry.first < best.first))) {
+				block.code, best = code, entry
+			}
+		}
+
+		label := capacitySuffixPattern.ReplaceAllString(block.label, "")
+		level := firstLevel[i]
+		if best != nil && best.level != "" {
+			level = best.level
+		}
+		switch {
+		case level != "" && strings.HasPrefix(label, level+" - "):
+			block.level, block.instructor = level, strings.TrimPrefix(label, level+" - ")
+		case level != "":
+			block.level = label
+		default:
+			block.level = label
+			if index := strings.LastIndex(label, " - "); index > 0 {
+				block.level, block.instructor = label[:index], label[index+3:]
+			}
+		}
+	}
+}
+
+// headerHasLevel reports whether a course header names level, alone or
+// followed by an instructor.
+func headerHasLevel(label string, level string) bool {
+	label = strings.ToLower(capacitySuffixPattern.ReplaceAllString(label, ""))
+	level = strings.ToLower(strings.TrimSpace(level))
+	return level != "" && (label == level || strings.HasPrefix(label, level+" - "))
+}
+
+// fillImportedClass sets the class fields of roster that are still empty.
+// Course headers win over the cells of students moved into the class.
+func fillImportedClass(roster *ClassRoster, values map[MasterListColumn]string, block *importBlock) {
+	set := func(field *string, value string) {
+		if *field == "" {
+			*field = strings.TrimSpace(value)
+		}
+	}
+	if block != nil {
+		set(&roster.ServiceName, block.level)
+		set(&roster.Instructor, block.instructor)
+		set(&roster.Time, block.time)
+	}
+	set(&roster.ServiceName, values[ColumnLevel])
+	set(&roster.Instructor, values[ColumnInstructor])
+	set(&roster.Time, values[ColumnTime])
+	set(&roster.Location, values[ColumnLocation])
+	set(&roster.Schedule, values[ColumnSchedule])
+	set(&roster.Day, values[ColumnDay])
+	set(&roster.DayLabel, values[ColumnDay])
+}
+
+func importedStudent(values map[MasterListColumn]string) RosterStudent {
+	name := SplitName(values[ColumnName])
+	student := RosterStudent{
+		Name:       values[ColumnName],
+		FirstName:  name.First,
+		LastName:   name.Last,
+		Phone:      values[ColumnPhone],
+		Instructor: values[ColumnInstructor],
+		Level:      values[ColumnLevel],
+		Guardian:   values[ColumnGuardian],
+	}
+	if age, err := strconv.Atoi(values[ColumnAge]); err == nil {
+		student.Age = &age
+	}
+	for _, alert := range strings.Split(values[ColumnMedicalAlerts], ";") {
+		if alert = strings.TrimSpace(alert); alert != "" {
+			student.MedicalAlerts = append(student.MedicalAlerts, alert)
+		}
+	}
+	return student
+}
+
+// ReconcileMasterList lines imported classes up with the rosters the
+// masterlist was printed from. Class fields the masterlist had no column for
+// are copied from the class with the same code, and students take the
+// spelling of the same student in reference, matched on first and last name,
+// so that a different name order does not read as a change.
+func ReconcileMasterList(classes []ClassRoster, reference []ClassRoster) {
+	names := map[string]string{}
+	byCode := rostersByCode(reference)
+	for _, roster := range reference {
+		for _, student := range roster.Students {
+			names[studentSortKey(student)] = student.Name
+		}
+	}
+
+	for i := range classes {
+		roster := &classes[i]
+		if original, ok := byCode[roster.Code]; ok {
+			fill := func(field *string, value string) {
+				if *field == "" {
+					*field = value
+				}
+			}
+			fill(&roster.ServiceName, original.ServiceName)
+			fill(&roster.Time, original.Time)
+			fill(&roster.Day, original.Day)
+			fill(&roster.DayLabel, original.DayLabel)
+			fill(&roster.Location, original.Location)
+			fill(&roster.Schedule, original.Schedule)
+			if roster.Day == original.DayLabel {
+				roster.Day = original.Day
+			}
+			if roster.Capacity == 0 {
+				roster.Capacity = original.Capacity
+			}
+		}
+		for j := range roster.Students {
+			student := &roster.Students[j]
+			if name, ok := names[studentSortKey(*student)]; ok {
+				student.Name = name
+			}
+		}
+	}
+}
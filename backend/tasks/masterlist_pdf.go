@@ -0,0 +1,511 @@
+package tasks
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"golang.org/x/text/encoding/charmap"
+)
+
+type PDFRenderer string
+
+const (
+	// PDFRendererAuto prints with Chrome and falls back to the native
+	// renderer when Chrome is missing or fails.
+	PDFRendererAuto   PDFRenderer = ""
+	PDFRendererChrome PDFRenderer = "chrome"
+	PDFRendererNative PDFRenderer = "native"
+)
+
+// ParsePDFRenderer accepts "chrome" and "native"; empty and "auto" mean
+// Chrome with the native renderer as fallback.
+func ParsePDFRenderer(value string) (PDFRenderer, bool) {
+	switch renderer := PDFRenderer(strings.ToLower(strings.TrimSpace(value))); renderer {
+	case PDFRendererAuto, "auto":
+		return PDFRendererAuto, true
+	case PDFRendererChrome, PDFRendererNative:
+		return renderer, true
+	}
+	return PDFRendererAuto, false
+}
+
+// The native renderer draws with the standard PDF fonts, so nothing needs
+// embedding, and sizes everything as the HTML masterlist does in CSS pixels.
+const (
+	pdfRegularFont  = "Helvetica"
+	pdfBoldFont     = "Helvetica-Bold"
+	pointsPerInch   = 72.0
+	pointsPerPixel  = 0.75
+	pdfLineHeight   = 1.15
+	pdfHeaderFill   = "F4F4F4"
+	pdfRunningColor = "333333"
+	// pdfRunningFontSize is the size of the running header and footer, in
+	// points, which the page scale does not shrink.
+	pdfRunningFontSize = 6.0
+)
+
+// pdfCellStyle is how one table cell is drawn. Colours are hex RGB; an empty
+// fill leaves the cell unfilled.
+type pdfCellStyle struct {
+	bold   bool
+	center bool
+	fill   string
+	color  string
+}
+
+type pdfCell struct {
+	text  string
+	span  int
+	style pdfCellStyle
+}
+
+// masterListPDF lays a masterlist out on pages, top to bottom. Coordinates
+// are PDF points from the bottom left of the page.
+type masterListPDF struct {
+	options FormatOptions
+	width   float64
+	height  float64
+	left    float64
+	right   float64
+	top     float64
+	bottom  float64
+
+	fontSize float64
+	padX     float64
+	padY     float64
+	border   float64
+
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+	// columns are the x positions of the column edges of the current table,
+	// and labels its header row, repeated on every page it spans.
+	columns []float64
+	labels  []string
+	// continued are the time and course headers repeated, marked "(cont.)",
+	// when the next row starts a new page.
+	continued []MasterListRow
+	// fresh reports whether nothing but the table header is on the page yet.
+	fresh bool
+}
+
+// WriteMasterListPDF draws the sections as a PDF without a browser, matching
+// the layout of the HTML masterlist: a table per section, each section after
+// the first on a new page, and the column headers repeated on every page.
+// options.KeepClassTogether, ContinuedHeaders and PageBreaks control where
+// pages break.
+// days is printed in the running header when options.HeaderFooter is set.
+func WriteMasterListPDF(sections []MasterListSection, options FormatOptions, days string) ([]byte, error) {
+	if len(sections) == 0 {
+		return nil, ErrEmptyMasterList
+	}
+
+	setup := options.PDFPage.WithDefaults(PDFPageSetup{})
+	width, height := setup.PageInches(options.Orientation)
+	marginX, marginY := setup.Margins(options.HeaderFooter)
+	scale := setup.Scale * pointsPerPixel
+	doc := &masterListPDF{
+		options:  options,
+		width:    width * pointsPerInch,
+		height:   height * pointsPerInch,
+		left:     marginX * pointsPerInch,
+		right:    (width - marginX) * pointsPerInch,
+		top:      (height - marginY) * pointsPerInch,
+		bottom:   marginY * pointsPerInch,
+		fontSize: setup.FontSize * scale,
+		padX:     4 * scale,
+		padY:     2 * scale,
+	}
+	if options.Borders {
+		doc.border = scale
+	}
+
+	for i, section := range sections {
+		doc.columns, doc.labels = nil, nil
+		if i == 0 || !doc.fresh {
+			doc.newPage()
+		}
+		doc.section(section)
+	}
+	if options.HeaderFooter {
+		doc.runningHeaders(strings.TrimSpace(options.SessionName), days, time.Now())
+	}
+	return doc.encode()
+}
+
+func (d *masterListPDF) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = d.top
+	d.fresh = true
+	if len(d.labels) > 0 {
+		d.tableHeader()
+	}
+	if d.options.ContinuedHeaders {
+		for _, header := range d.continued {
+			header.Label += " (cont.)"
+			d.row(d.rowCells(header))
+		}
+	}
+	d.fresh = true
+}
+
+func (d *masterListPDF) section(section MasterListSection) {
+	if section.Title != "" {
+		size := d.fontSize * 1.5
+		d.text(section.Title, d.left, d.y-d.baseline(size), size, true, "111111")
+		d.y -= size*pdfLineHeight + 6*d.padY
+	}
+
+	d.columns = []float64{d.left}
+	x := d.left
+	for _, percent := range MasterListColumnPercents(section.List) {
+		x += (d.right - d.left) * percent / 100
+		d.columns = append(d.columns, x)
+	}
+	d.labels = section.List.Labels()
+	d.continued = nil
+	d.tableHeader()
+
+	// under returns the headers a row sits under, which are repeated if the
+	// row starts a new page.
+	var timeHeader, courseHeader *MasterListRow
+	under := func(row MasterListRow) []MasterListRow {
+		headers := []MasterListRow{}
+		if row.Kind == MasterListTimeHeader {
+			return headers
+		}
+		if timeHeader != nil && timeHeader.Time == row.Time {
+			headers = append(headers, *timeHeader)
+		}
+		if row.Kind != MasterListCourseHeader && courseHeader != nil && courseHeader.Code == row.Code {
+			headers = append(headers, *courseHeader)
+		}
+		return headers
+	}
+	for _, group := range MasterListPageGroups(section.List.Rows, d.options.PageBreaks) {
+		d.continued = under(group.Rows[0])
+		if group.Break && !d.fresh {
+			d.newPage()
+		}
+		if d.options.KeepClassTogether {
+			d.keep(group.Rows)
+		}
+		for i, row := range group.Rows {
+			d.continued = under(row)
+			switch row.Kind {
+			case MasterListTimeHeader:
+				timeHeader, courseHeader = &group.Rows[i], nil
+			case MasterListCourseHeader:
+				courseHeader = &group.Rows[i]
+			}
+			d.row(d.rowCells(row))
+		}
+	}
+}
+
+// keep starts a new page when rows would not fit on this one but would on a
+// page of their own. Taller rows keep at least their headers and first
+// student together.
+func (d *masterListPDF) keep(rows []MasterListRow) {
+	if d.fresh || d.y-d.rowsHeight(rows) >= d.bottom {
+		return
+	}
+	room := d.top - d.bottom - d.rowHeight(d.tableHeaderCells())
+	if d.rowsHeight(rows) > room {
+		lead := 0
+		for lead < len(rows)-1 && rows[lead].Kind != MasterListStudentRow {
+			lead++
+		}
+		if d.y-d.rowsHeight(rows[:lead+1]) >= d.bottom {
+			return
+		}
+	}
+	d.newPage()
+}
+
+func (d *masterListPDF) rowsHeight(rows []MasterListRow) float64 {
+	height := 0.0
+	for _, row := range rows {
+		height += d.rowHeight(d.rowCells(row))
+	}
+	return height
+}
+
+func (d *masterListPDF) tableHeader() {
+	d.row(d.tableHeaderCells())
+}
+
+func (d *masterListPDF) tableHeaderCells() []pdfCell {
+	cells := make([]pdfCell, len(d.labels))
+	for i, label := range d.labels {
+		cells[i] = pdfCell{text: label, span: 1, style: pdfCellStyle{bold: true, center: true}}
+	}
+	return cells
+}
+
+// rowCells styles a masterlist row like buildMasterListHTML does.
+func (d *masterListPDF) rowCells(row MasterListRow) []pdfCell {
+	columns := len(d.columns) - 1
+	switch row.Kind {
+	case MasterListTimeHeader, MasterListCourseHeader:
+		style := pdfCellStyle{fill: pdfHeaderFill}
+		if row.Kind == MasterListTimeHeader {
+			style.bold, style.center = d.options.BoldTime, d.options.CenterTime
+		} else {
+			style.bold, style.center = d.options.BoldCourse, d.options.CenterCourse
+			if d.options.HighlightEnrollment {
+				switch row.Enrollment {
+				case EnrollmentSingle:
+					style.fill, style.color = singleEnrollmentFill, "FFFFFF"
+				case EnrollmentLow:
+					style.fill = lowEnrollmentFill
+				}
+			}
+		}
+		return []pdfCell{{text: row.Label, span: columns, style: style}}
+	case MasterListTotalRow:
+		style := pdfCellStyle{bold: true, fill: totalFill}
+		if columns > 1 {
+			return []pdfCell{
+				{text: row.Label, span: columns - 1, style: style},
+				{text: strconv.Itoa(row.Count), span: 1, style: style},
+			}
+		}
+		return []pdfCell{{text: fmt.Sprintf("%s: %d", row.Label, row.Count), span: columns, style: style}}
+	}
+	cells := make([]pdfCell, columns)
+	for i := range cells {
+		cells[i].span = 1
+		if i < len(row.Cells) {
+			cells[i].text = row.Cells[i]
+		}
+	}
+	return cells
+}
+
+// row draws one table row, moving to a new page first when the row does not
+// fit, since rows are never split across pages.
+func (d *masterListPDF) row(cells []pdfCell) {
+	lineHeight := d.fontSize * pdfLineHeight
+	lines, height := d.wrapRow(cells)
+	if d.y-height < d.bottom && !d.fresh {
+		d.newPage()
+	}
+
+	column := 0
+	for i, cell := range cells {
+		x0, x1 := d.columns[column], d.columns[min(column+cell.span, len(d.columns)-1)]
+		column += cell.span
+		if cell.style.fill != "" {
+			fmt.Fprintf(d.page, "%s rg %.2f %.2f %.2f %.2f re f\n", pdfColor(cell.style.fill), x0, d.y-height, x1-x0, height)
+		}
+		if d.border > 0 {
+			fmt.Fprintf(d.page, "0 0 0 RG %.2f w %.2f %.2f %.2f %.2f re S\n", d.border, x0, d.y-height, x1-x0, height)
+		}
+		color := cell.style.color
+		if color == "" {
+			color = "111111"
+		}
+		baseline := d.y - d.padY - d.baseline(d.fontSize)
+		for _, line := range lines[i] {
+			x := x0 + d.padX
+			if cell.style.center {
+				x = (x0 + x1 - pdfTextWidth(line, cellFont(cell.style), d.fontSize)) / 2
+			}
+			d.text(line, x, baseline, d.fontSize, cell.style.bold, color)
+			baseline -= lineHeight
+		}
+	}
+	d.y -= height
+	d.fresh = false
+}
+
+// wrapRow breaks the text of each cell into lines and returns them with the
+// height of the row.
+func (d *masterListPDF) wrapRow(cells []pdfCell) ([][]string, float64) {
+	lineHeight := d.fontSize * pdfLineHeight
+	lines := make([][]string, len(cells))
+	height := lineHeight
+	column := 0
+	for i, cell := range cells {
+		x0, x1 := d.columns[column], d.columns[min(column+cell.span, len(d.columns)-1)]
+		lines[i] = wrapPDFText(cell.text, cellFont(cell.style), d.fontSize, x1-x0-2*d.padX)
+		height = max(height, float64(len(lines[i]))*lineHeight)
+		column += cell.span
+	}
+	return lines, height + 2*d.padY
+}
+
+func (d *masterListPDF) rowHeight(cells []pdfCell) float64 {
+	_, height := d.wrapRow(cells)
+	return height
+}
+
+// baseline is the distance from the top of a line of text to its baseline.
+func (d *masterListPDF) baseline(size float64) float64 {
+	return size*(pdfLineHeight-1)/2 + size*0.8
+}
+
+func (d *masterListPDF) text(value string, x float64, y float64, size float64, bold bool, color string) {
+	if value == "" {
+		return
+	}
+	fontName := "F1"
+	if bold {
+		fontName = "F2"
+	}
+	fmt.Fprintf(d.page, "BT %s rg /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", pdfColor(color), fontName, size, x, y, pdfEscape(encodeWinAnsi(value)))
+}
+
+// runningHeaders prints the session, days and time of printing above every
+// page and "Page X of Y" below it.
+func (d *masterListPDF) runningHeaders(session string, days string, printed time.Time) {
+	size := pdfRunningFontSize
+	headerY := d.height - (d.height-d.top)/2 - size/2
+	footerY := d.bottom/2 - size/2
+	generated := "Generated " + printed.Format("Jan 2, 2006 3:04 PM")
+	for i, page := range d.pages {
+		d.page = page
+		d.text(session, d.left, headerY, size, true, pdfRunningColor)
+		d.text(days, (d.left+d.right-pdfTextWidth(days, pdfRegularFont, size))/2, headerY, size, false, pdfRunningColor)
+		d.text(generated, d.right-pdfTextWidth(generated, pdfRegularFont, size), headerY, size, false, pdfRunningColor)
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		d.text(footer, (d.left+d.right-pdfTextWidth(footer, pdfRegularFont, size))/2, footerY, size, false, pdfRunningColor)
+	}
+}
+
+// encode writes the pages out as a PDF file with compressed content streams.
+func (d *masterListPDF) encode() ([]byte, error) {
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /" + pdfRegularFont + " /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /" + pdfBoldFont + " /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		var content bytes.Buffer
+		writer := zlib.NewWriter(&content)
+		if _, err := writer.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			d.width, d.height, 6+2*i,
+		))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+	object("<< /Title (Masterlist) /Producer (cob-aquatics) >>")
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), xref)
+	return out.Bytes(), nil
+}
+
+func cellFont(style pdfCellStyle) string {
+	if style.bold {
+		return pdfBoldFont
+	}
+	return pdfRegularFont
+}
+
+// wrapPDFText breaks text into lines no wider than width, at spaces where it
+// can and inside words that are too long for a line on their own.
+func wrapPDFText(text string, fontName string, size float64, width float64) []string {
+	lines := []string{}
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdfTextWidth(candidate, fontName, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		// A column narrower than its padding still takes one glyph a line.
+		for word != "" && pdfTextWidth(word, fontName, size) > width {
+			runes := []rune(word)
+			cut := 1
+			for cut < len(runes) && pdfTextWidth(string(runes[:cut+1]), fontName, size) <= width {
+				cut++
+			}
+			lines = append(lines, string(runes[:cut]))
+			word = string(runes[cut:])
+		}
+		line = word
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func pdfTextWidth(text string, fontName string, size float64) float64 {
+	width := 0
+	for _, b := range encodeWinAnsi(text) {
+		width += font.CharWidth(fontName, rune(b))
+	}
+	return float64(width) * size / 1000
+}
+
+// encodeWinAnsi converts text to the encoding of the standard fonts, with a
+// question mark for characters it lacks.
+func encodeWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		b, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			b = '?'
+		}
+		encoded = append(encoded, b)
+	}
+	return encoded
+}
+
+func pdfEscape(text []byte) string {
+	var escaped strings.Builder
+	for _, b := range text {
+		switch b {
+		case '(', ')', '\\':
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(b)
+	}
+	return escaped.String()
+}
+
+// pdfColor turns a hex RGB colour into PDF colour components.
+func pdfColor(hex string) string {
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return "0 0 0"
+	}
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(value>>16&0xFF)/255, float64(value>>8&0xFF)/255, float64(value&0xFF)/255)
+}
@@ -0,0 +1,58 @@
+package tasks
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrapPDFTextNarrowerThanPadding(t *testing.T) {
+	lines := wrapPDFText("12 yrs", "Helvetica", 9, -2)
+	if got := strings.Join(lines, ""); got != "12yrs" {
+		t.Fatalf("wrapPDFText kept %q, want every glyph", got)
+	}
+	for _, line := range lines {
+		if len([]rune(line)) != 1 {
+			t.Fatalf("wrapPDFText line %q, want one glyph a line", line)
+		}
+	}
+}
+
+func TestMasterListColumnPercentsMinimum(t *testing.T) {
+	age := 7
+	rosters := []ClassRoster{{
+		Code:        "100",
+		ServiceName: "Splash 3",
+		Day:         "Monday",
+		Time:        "9:00 AM",
+		Students: []RosterStudent{{
+			Name:          "Zed Smith",
+			Age:           &age,
+			MedicalAlerts: []string{strings.Repeat("Severe peanut allergy, carries an EpiPen. ", 7)},
+		}},
+	}}
+	options := FormatOptions{ShowAge: true, ShowMedicalAlerts: true}
+	sections, err := MasterListSections(rosters, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0.0
+	for _, percent := range MasterListColumnPercents(sections[0].List) {
+		if percent < minColumnPercent-1e-9 {
+			t.Errorf("column width %.2f%%, want at least %.2f%%", percent, minColumnPercent)
+		}
+		total += percent
+	}
+	if total < 99.99 || total > 100.01 {
+		t.Errorf("column widths add up to %.2f%%, want 100%%", total)
+	}
+
+	pdf, err := WriteMasterListPDF(sections, options, "Monday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("WriteMasterListPDF wrote %q, want a PDF", pdf[:min(len(pdf), 8)])
+	}
+}
@@ -0,0 +1,443 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrEmptyMasterList = errors.New("no student rows to process")
+
+type MasterListFormat string
+
+const (
+	MasterListXLSX MasterListFormat = "xlsx"
+	MasterListPDF  MasterListFormat = "pdf"
+	MasterListCSV  MasterListFormat = "csv"
+	MasterListHTML MasterListFormat = "html"
+)
+
+// ParseMasterListFormat accepts the MasterListFormat names; empty means
+// fallback.
+func ParseMasterListFormat(value string, fallback MasterListFormat) (MasterListFormat, bool) {
+	switch format := MasterListFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case "":
+		return fallback, true
+	case MasterListXLSX, MasterListPDF, MasterListCSV, MasterListHTML:
+		return format, true
+	}
+	return fallback, false
+}
+
+// MasterListFilename names a masterlist download after today's date.
+func MasterListFilename(format MasterListFormat) string {
+	now := time.Now()
+	return fmt.Sprintf("MasterList_%d_%d_%d.%s", now.Month(), now.Day(), now.Year(), format)
+}
+
+type MasterListRowKind int
+
+const (
+	MasterListStudentRow MasterListRowKind = iota
+	MasterListTimeHeader
+	MasterListCourseHeader
+	// MasterListTotalRow counts the students of one or more classes.
+	MasterListTotalRow
+)
+
+// MasterListRow is one row below the column headers: a student, or a header
+// row inserted between blocks.
+type MasterListRow struct {
+	Kind MasterListRowKind
+	// Label is the text of a header row and Cells the values of a student
+	// row, in column order.
+	Label string
+	Cells []string
+	// Code, Time and Instructor describe the class the row belongs to.
+	Code       string
+	Time       string
+	Instructor string
+	// Enrollment is set on course headers.
+	Enrollment EnrollmentStatus
+	// Count is the number of students a total row counts, in the classes
+	// listed in Classes by code.
+	Count   int
+	Classes []string
+}
+
+// masterListTotal collects the classes counted by one total row.
+type masterListTotal struct {
+	label   string
+	count   int
+	classes []string
+}
+
+func (t *masterListTotal) add(code string, count int) {
+	t.count += count
+	t.classes = append(t.classes, code)
+}
+
+func (t masterListTotal) row() MasterListRow {
+	return MasterListRow{Kind: MasterListTotalRow, Label: t.label, Count: t.count, Classes: t.classes}
+}
+
+// masterListTotals keeps one total per name, such as per level, in the order
+// the names were first seen.
+type masterListTotals struct {
+	totals map[string]*masterListTotal
+	order  []string
+}
+
+func (t *masterListTotals) add(name string, code string, count int) {
+	key := strings.ToLower(name)
+	if t.totals == nil {
+		t.totals = map[string]*masterListTotal{}
+	}
+	total, ok := t.totals[key]
+	if !ok {
+		total = &masterListTotal{label: name}
+		t.totals[key] = total
+		t.order = append(t.order, key)
+	}
+	total.add(code, count)
+}
+
+// rows returns a total row per name in natural order, labelled with prefix.
+// The blank name comes last, labelled blank.
+func (t masterListTotals) rows(prefix string, blank string) []MasterListRow {
+	keys := append([]string{}, t.order...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return compareBlankLast(keys[i], keys[j]) < 0
+	})
+	rows := make([]MasterListRow, 0, len(keys))
+	for _, key := range keys {
+		total := *t.totals[key]
+		if key == "" {
+			total.label = blank
+		}
+		total.label = fmt.Sprintf("%s: %s", prefix, total.label)
+		rows = append(rows, total.row())
+	}
+	return rows
+}
+
+// MasterList is the laid-out content of a masterlist, shared by every output
+// format.
+type MasterList struct {
+	Columns []ColumnSpec
+	Rows    []MasterListRow
+}
+
+// MasterListSection is part of a masterlist printed on a page or sheet of its
+// own, such as one instructor's classes.
+type MasterListSection struct {
+	Title string
+	List  MasterList
+}
+
+// MasterListSections lays rosters out with BuildMasterList. The instructor
+// layout gives one section per instructor, with their classes in time order;
+// other layouts give a single untitled section.
+func MasterListSections(rosters []ClassRoster, options FormatOptions) ([]MasterListSection, error) {
+	if options.Layout != LayoutByInstructor {
+		list, err := BuildMasterList(rosters, options)
+		if err != nil {
+			return nil, err
+		}
+		return []MasterListSection{{List: list}}, nil
+	}
+
+	options.SortOrder = SortByTime
+	if len(options.Columns) == 0 {
+		options.Columns = InstructorMasterListColumns(options)
+	}
+	sections := []MasterListSection{}
+	for _, group := range instructorGroups(rosters) {
+		list, err := BuildMasterList(group.rosters, options)
+		if errors.Is(err, ErrEmptyMasterList) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, MasterListSection{Title: group.name, List: list})
+	}
+	if len(sections) == 0 {
+		return nil, ErrEmptyMasterList
+	}
+	return sections, nil
+}
+
+// sectionHeading joins a session name and a section title for a page header.
+func sectionHeading(sessionName string, title string) string {
+	sessionName, title = strings.TrimSpace(sessionName), strings.TrimSpace(title)
+	switch {
+	case sessionName == "":
+		return title
+	case title == "":
+		return sessionName
+	}
+	return sessionName + " — " + title
+}
+
+// BuildMasterList sorts rosters and lays them out with the headers chosen in
+// options. A time header starts each new class time and a course header
+// starts every class. Total rows follow the class or time block they count,
+// and the level, instructor and grand totals close the list. Students without
+// a name and classes without a code or students are left out.
+func BuildMasterList(rosters []ClassRoster, options FormatOptions) (MasterList, error) {
+	columns := optedInColumns(options.Columns, options)
+	if len(columns) == 0 {
+		columns = DefaultMasterListColumns(true, options)
+	}
+
+	rosters = append([]ClassRoster{}, rosters...)
+	for i := range rosters {
+		rosters[i].Students = append([]RosterStudent{}, rosters[i].Students...)
+	}
+	SortRosters(rosters, options.SortOrder)
+
+	rows := []MasterListRow{}
+	previousTime := ""
+	block := masterListTotal{}
+	var levels, instructors masterListTotals
+	grand := masterListTotal{label: "Total students"}
+	closeBlock := func() {
+		if options.TimeTotals && len(block.classes) > 0 {
+			block.label = "No time total"
+			if previousTime != "" {
+				block.label = previousTime + " total"
+			}
+			total := block.row()
+			total.Time = previousTime
+			rows = append(rows, total)
+		}
+		block = masterListTotal{}
+	}
+	for _, roster := range rosters {
+		code := strings.TrimSpace(roster.Code)
+		if code == "" {
+			continue
+		}
+
+		classRows := []MasterListRow{}
+		var first masterListEntry
+		for _, student := range roster.Students {
+			if student.DisplayName(options.NameDisplay) == "" {
+				continue
+			}
+			entry := rosterEntry(roster, student, options.NameDisplay)
+			if len(classRows) == 0 {
+				first = entry
+			}
+			classRows = append(classRows, MasterListRow{
+				Kind:       MasterListStudentRow,
+				Cells:      entry.cells(columns),
+				Code:       code,
+				Time:       entry.values[ColumnTime],
+				Instructor: entry.values[ColumnInstructor],
+			})
+		}
+		if len(classRows) == 0 {
+			continue
+		}
+
+		eventTime, instructor := first.values[ColumnTime], first.values[ColumnInstructor]
+		if eventTime != previousTime {
+			closeBlock()
+			if options.TimeHeaders && eventTime != "" {
+				rows = append(rows, MasterListRow{Kind: MasterListTimeHeader, Label: eventTime, Code: code, Time: eventTime, Instructor: instructor})
+			}
+			previousTime = eventTime
+		}
+		if options.CourseHeaders {
+			label := first.values[ColumnLevel]
+			if label == "" {
+				label = code
+			}
+			if options.InstructorHeaders && instructor != "" {
+				label = fmt.Sprintf("%s - %s", label, instructor)
+			}
+			if options.ShowCapacity {
+				label = CapacityLabel(label, first.enrolled, first.capacity)
+			} else if options.ShowClassCount {
+				label = ClassCountLabel(label, len(classRows))
+			}
+			rows = append(rows, MasterListRow{
+				Kind:       MasterListCourseHeader,
+				Label:      label,
+				Code:       code,
+				Time:       eventTime,
+				Instructor: instructor,
+				Enrollment: first.enrollmentStatus(),
+			})
+		}
+		rows = append(rows, classRows...)
+
+		count := len(classRows)
+		if options.ClassTotals {
+			class := masterListTotal{label: "Class total"}
+			class.add(code, count)
+			total := class.row()
+			total.Code, total.Time, total.Instructor = code, eventTime, instructor
+			rows = append(rows, total)
+		}
+		block.add(code, count)
+		grand.add(code, count)
+		levels.add(first.values[ColumnLevel], code, count)
+		instructors.add(instructor, code, count)
+	}
+	if len(rows) == 0 {
+		return MasterList{}, ErrEmptyMasterList
+	}
+
+	closeBlock()
+	if options.LevelTotals {
+		rows = append(rows, levels.rows("Level", "None")...)
+	}
+	if options.InstructorTotals {
+		rows = append(rows, instructors.rows("Instructor", unassignedSheetName)...)
+	}
+	if options.GrandTotal {
+		rows = append(rows, grand.row())
+	}
+	return MasterList{Columns: columns, Rows: rows}, nil
+}
+
+// Labels returns the column header labels.
+func (l MasterList) Labels() []string {
+	labels := make([]string, len(l.Columns))
+	for i, column := range l.Columns {
+		labels[i] = column.Label
+	}
+	return labels
+}
+
+// WriteMasterListCSV writes the column headers of the first section, then
+// each section's rows as CSV. Header rows and section titles keep their text
+// in the first column, and total rows put their count in the last.
+func WriteMasterListCSV(sections []MasterListSection) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if len(sections) == 0 {
+		return nil, ErrEmptyMasterList
+	}
+	width := len(sections[0].List.Columns)
+	labelRow := func(label string) []string {
+		cells := make([]string, width)
+		if len(cells) == 0 {
+			cells = []string{""}
+		}
+		cells[0] = label
+		return cells
+	}
+
+	if err := writer.Write(sections[0].List.Labels()); err != nil {
+		return nil, err
+	}
+	for _, section := range sections {
+		if section.Title != "" {
+			if err := writer.Write(labelRow(section.Title)); err != nil {
+				return nil, err
+			}
+		}
+		for _, row := range section.List.Rows {
+			cells := row.Cells
+			switch row.Kind {
+			case MasterListTimeHeader, MasterListCourseHeader:
+				cells = labelRow(row.Label)
+			case MasterListTotalRow:
+				cells = labelRow(row.Label)
+				if len(cells) > 1 {
+					cells[len(cells)-1] = strconv.Itoa(row.Count)
+				} else {
+					cells = append(cells, strconv.Itoa(row.Count))
+				}
+			}
+			if err := writer.Write(cells); err != nil {
+				return nil, err
+			}
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// minColumnPercent keeps short columns such as Age readable beside a long
+// medical alert.
+const minColumnPercent = 5.0
+
+// MasterListColumnPercents shares the page width between the columns in
+// proportion to their longest header or student value, giving each column at
+// least minColumnPercent.
+func MasterListColumnPercents(list MasterList) []float64 {
+	headers := list.Labels()
+	widths := make([]float64, len(headers))
+	if len(headers) == 0 {
+		return widths
+	}
+	maxLengths := make([]int, len(headers))
+	for i, header := range headers {
+		maxLengths[i] = len([]rune(header))
+	}
+
+	for _, row := range list.Rows {
+		if row.Kind != MasterListStudentRow {
+			continue
+		}
+		for i, cell := range row.Cells {
+			if i >= len(maxLengths) {
+				break
+			}
+			length := len([]rune(cell))
+			if length > maxLengths[i] {
+				maxLengths[i] = length
+			}
+		}
+	}
+	for i := range maxLengths {
+		if maxLengths[i] < 1 {
+			maxLengths[i] = 1
+		}
+	}
+	if float64(len(headers))*minColumnPercent >= 100 {
+		for i := range widths {
+			widths[i] = 100.0 / float64(len(headers))
+		}
+		return widths
+	}
+
+	// Columns below the minimum are raised to it and the rest share what is
+	// left, until no column falls below.
+	fixed := make([]bool, len(headers))
+	for {
+		remaining, total := 100.0, 0
+		for i, length := range maxLengths {
+			if fixed[i] {
+				remaining -= minColumnPercent
+			} else {
+				total += length
+			}
+		}
+		changed := false
+		for i, length := range maxLengths {
+			if fixed[i] {
+				widths[i] = minColumnPercent
+				continue
+			}
+			widths[i] = float64(length) / float64(total) * remaining
+			if widths[i] < minColumnPercent {
+				fixed[i] = true
+				changed = true
+			}
+		}
+		if !changed {
+			return widths
+		}
+	}
+}
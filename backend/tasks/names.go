@@ -0,0 +1,220 @@
+package tasks
+
+import (
+	"strings"
+	"unicode"
+)
+
+type NameDisplay string
+
+const (
+	NameDisplaySource    NameDisplay = ""
+	NameDisplayFirstLast NameDisplay = "first_last"
+	NameDisplayLastFirst NameDisplay = "last_first"
+)
+
+// macExceptions are surnames starting with "Mac" that are not Scottish
+// patronymics and keep a lowercase fourth letter.
+var macExceptions = map[string]bool{
+	"mace": true, "macey": true, "macy": true, "mack": true, "mackey": true,
+	"mackie": true, "macon": true, "macias": true, "maciel": true,
+	"machado": true, "machin": true, "macho": true, "macek": true,
+}
+
+var romanNumerals = map[string]bool{
+	"ii": true, "iii": true, "iv": true, "vi": true, "vii": true, "viii": true,
+}
+
+type PersonName struct {
+	First     string `json:"firstName"`
+	Last      string `json:"lastName"`
+	Preferred string `json:"preferredName,omitempty"`
+}
+
+// ParseNameDisplay accepts "first_last" and "last_first" (hyphens and case
+// are ignored). An empty value keeps the order of the source.
+func ParseNameDisplay(value string) (NameDisplay, bool) {
+	normalized := NameDisplay(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(value)), "-", "_"))
+	switch normalized {
+	case NameDisplaySource, NameDisplayFirstLast, NameDisplayLastFirst:
+		return normalized, true
+	}
+	return NameDisplaySource, false
+}
+
+// Display formats the name, using the preferred name in place of the first
+// name when there is one. NameDisplaySource is treated as first_last.
+func (n PersonName) Display(display NameDisplay) string {
+	first := n.First
+	if n.Preferred != "" {
+		first = n.Preferred
+	}
+	switch {
+	case n.Last == "":
+		return first
+	case first == "":
+		return n.Last
+	case display == NameDisplayLastFirst:
+		return n.Last + ", " + first
+	}
+	return first + " " + n.Last
+}
+
+// SplitName splits a full name written as "Last, First" or "First Last" and
+// normalizes both parts. Middle names stay with the first name.
+func SplitName(value string) PersonName {
+	value = NormalizeName(value)
+	if last, first, ok := strings.Cut(value, ","); ok {
+		return PersonName{First: strings.TrimSpace(first), Last: strings.TrimSpace(last)}
+	}
+	return splitFirstLast(value)
+}
+
+func splitFirstLast(name string) PersonName {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return PersonName{First: normalizeGivenName(name)}
+	}
+	return PersonName{
+		First: normalizeGivenName(strings.Join(parts[:len(parts)-1], " ")),
+		Last:  normalizeSurname(parts[len(parts)-1]),
+	}
+}
+
+func splitLastFirst(name string) PersonName {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return PersonName{First: normalizeGivenName(name)}
+	}
+	return PersonName{First: normalizeGivenName(strings.Join(parts[1:], " ")), Last: normalizeSurname(parts[0])}
+}
+
+// FormatName normalizes a full name and, unless display is NameDisplaySource,
+// reorders it. A non-empty preferred name replaces the first name.
+func FormatName(value string, preferred string, display NameDisplay) string {
+	preferred = normalizeGivenName(preferred)
+	if display == NameDisplaySource {
+		if preferred == "" {
+			return NormalizeName(value)
+		}
+		display = NameDisplayFirstLast
+		if strings.Contains(value, ",") {
+			display = NameDisplayLastFirst
+		}
+	}
+	name := SplitName(value)
+	name.Preferred = preferredName(name.First, preferred)
+	return name.Display(display)
+}
+
+// NormalizeName collapses whitespace and fixes the casing of words written
+// entirely in upper or lower case. Mixed-case words such as "DeVries" are
+// left alone, and diacritics are kept. "Mac" and "Mc" surnames are read as
+// "MacDonald"; the surname is what comes before a comma, or else the last
+// word.
+func NormalizeName(value string) string {
+	words := strings.Fields(strings.ReplaceAll(value, ",", ", "))
+	first, last := len(words), len(words)-1
+	if len(words) >= 2 {
+		first = last
+	}
+	for i, word := range words {
+		if strings.Contains(word, ",") {
+			first, last = 0, i
+			break
+		}
+	}
+	for i, word := range words {
+		words[i] = normalizeNameWord(word, i >= first && i <= last)
+	}
+	return strings.ReplaceAll(strings.Join(words, " "), " ,", ",")
+}
+
+// normalizeGivenName and normalizeSurname normalize a name part held on its
+// own, such as a first name column, like NormalizeName.
+func normalizeGivenName(value string) string {
+	return normalizeNameWords(value, false)
+}
+
+func normalizeSurname(value string) string {
+	return normalizeNameWords(value, true)
+}
+
+func normalizeNameWords(value string, surname bool) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		words[i] = normalizeNameWord(word, surname)
+	}
+	return strings.Join(words, " ")
+}
+
+// DisplayName formats the student's name for display. Students imported
+// with separate name parts are reordered from those; otherwise Name is
+// parsed.
+func (s RosterStudent) DisplayName(display NameDisplay) string {
+	if display == NameDisplaySource || (s.FirstName == "" && s.LastName == "") {
+		return FormatName(s.Name, "", display)
+	}
+	return PersonName{First: s.FirstName, Last: s.LastName, Preferred: s.PreferredName}.Display(display)
+}
+
+func preferredName(first string, preferred string) string {
+	if preferred == "" || strings.EqualFold(preferred, first) {
+		return ""
+	}
+	if fields := strings.Fields(first); len(fields) > 0 && strings.EqualFold(preferred, fields[0]) {
+		return ""
+	}
+	return preferred
+}
+
+func normalizeNameWord(word string, surname bool) string {
+	if word == "," {
+		return word
+	}
+	hasUpper, hasLower := false, false
+	for _, r := range word {
+		hasUpper = hasUpper || unicode.IsUpper(r)
+		hasLower = hasLower || unicode.IsLower(r)
+	}
+	if hasUpper && hasLower {
+		return word
+	}
+
+	lower := strings.ToLower(word)
+	if romanNumerals[strings.Trim(lower, ".,")] {
+		return strings.ToUpper(word)
+	}
+
+	segments := strings.Split(lower, "-")
+	for i, segment := range segments {
+		segments[i] = capitalizeNameSegment(segment, surname)
+	}
+	return strings.Join(segments, "-")
+}
+
+func capitalizeNameSegment(segment string, surname bool) string {
+	runes := []rune(segment)
+	start := true
+	for i, r := range runes {
+		if start && unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+			start = false
+		}
+		if r == '\'' || r == '’' {
+			start = true
+		}
+	}
+
+	word := strings.TrimRight(segment, ".,")
+	switch {
+	case !surname:
+		// Given names such as Mackenzie and Macy keep a lowercase fourth
+		// letter.
+	case strings.HasPrefix(word, "mc") && len(runes) > 2 && unicode.IsLetter(runes[2]):
+		runes[2] = unicode.ToUpper(runes[2])
+	case strings.HasPrefix(word, "mac") && len(runes) > 5 && unicode.IsLetter(runes[3]) && !macExceptions[word]:
+		runes[3] = unicode.ToUpper(runes[3])
+	}
+	return string(runes)
+}
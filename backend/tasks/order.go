@@ -0,0 +1,211 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type SortOrder string
+
+const (
+	// SortByTime orders classes by meeting day and start time, then level,
+	// then class code. Students are ordered by name within each class.
+	SortByTime       SortOrder = "time"
+	SortByInstructor SortOrder = "instructor"
+	SortByLocation   SortOrder = "location"
+	SortByLevel      SortOrder = "level"
+	SortByCode       SortOrder = "code"
+)
+
+// classSortKey holds the parsed values classes are ordered by.
+type classSortKey struct {
+	day        int
+	start      int
+	level      string
+	code       string
+	instructor string
+	location   string
+}
+
+// ParseSortOrder accepts the SortOrder names; empty means SortByTime.
+func ParseSortOrder(value string) (SortOrder, bool) {
+	switch order := SortOrder(strings.ToLower(strings.TrimSpace(value))); order {
+	case "":
+		return SortByTime, true
+	case SortByTime, SortByInstructor, SortByLocation, SortByLevel, SortByCode:
+		return order, true
+	}
+	return SortByTime, false
+}
+
+// SortRosters orders classes and the students within them in place. The sort
+// is stable, so equal classes keep their input order.
+func SortRosters(rosters []ClassRoster, order SortOrder) {
+	keys := make([]classSortKey, len(rosters))
+	indexes := make([]int, len(rosters))
+	for i := range rosters {
+		keys[i] = rosterSortKey(rosters[i])
+		indexes[i] = i
+		SortStudents(rosters[i].Students)
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return compareClassKeys(keys[indexes[i]], keys[indexes[j]], order) < 0
+	})
+	sorted := make([]ClassRoster, len(rosters))
+	for i, index := range indexes {
+		sorted[i] = rosters[index]
+	}
+	copy(rosters, sorted)
+}
+
+// SortStudents orders students by last name, then first name.
+func SortStudents(students []RosterStudent) {
+	sort.SliceStable(students, func(i, j int) bool {
+		return naturalCompare(studentSortKey(students[i]), studentSortKey(students[j])) < 0
+	})
+}
+
+func rosterSortKey(roster ClassRoster) classSortKey {
+	timing := roster.ParsedSchedule()
+	key := classSortKey{
+		day:        firstWeekday(roster.MeetingDays()),
+		start:      -1,
+		level:      strings.TrimSpace(roster.ServiceName),
+		code:       strings.TrimSpace(roster.Code),
+		instructor: strings.TrimSpace(roster.Instructor),
+		location:   strings.TrimSpace(roster.Location),
+	}
+	if timing.HasTime {
+		key.start = timing.StartMinutes
+	}
+	if key.level == "" && len(roster.Students) > 0 {
+		key.level = strings.TrimSpace(roster.Students[0].Level)
+	}
+	if key.instructor == "" && len(roster.Students) > 0 {
+		key.instructor = strings.TrimSpace(roster.Students[0].Instructor)
+	}
+	return key
+}
+
+func studentSortKey(student RosterStudent) string {
+	if student.LastName != "" || student.FirstName != "" {
+		return nameSortKey(PersonName{First: student.FirstName, Last: student.LastName})
+	}
+	return nameSortKey(SplitName(student.Name))
+}
+
+func nameSortKey(name PersonName) string {
+	return strings.ToLower(name.Last + "\x00" + name.First)
+}
+
+func firstWeekday(days []string) int {
+	first := len(weekdayOrder)
+	for _, day := range days {
+		if index := weekdayIndex(day); index >= 0 && index < first {
+			first = index
+		}
+	}
+	return first
+}
+
+// compareClassKeys compares two classes under the given order. Classes
+// without a start time, instructor or location sort after those with one.
+func compareClassKeys(a classSortKey, b classSortKey, order SortOrder) int {
+	byTime := func() int {
+		if c := compareInts(a.day, b.day); c != 0 {
+			return c
+		}
+		return compareStarts(a.start, b.start)
+	}
+	byLevel := func() int { return naturalCompare(a.level, b.level) }
+	byCode := func() int { return naturalCompare(a.code, b.code) }
+
+	var steps []func() int
+	switch order {
+	case SortByInstructor:
+		steps = []func() int{func() int { return compareBlankLast(a.instructor, b.instructor) }, byTime, byLevel, byCode}
+	case SortByLocation:
+		steps = []func() int{func() int { return compareBlankLast(a.location, b.location) }, byTime, byLevel, byCode}
+	case SortByLevel:
+		steps = []func() int{byLevel, byTime, byCode}
+	case SortByCode:
+		steps = []func() int{byCode}
+	default:
+		steps = []func() int{byTime, byLevel, byCode}
+	}
+	for _, step := range steps {
+		if c := step(); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareStarts(a int, b int) int {
+	switch {
+	case a < 0 && b < 0:
+		return 0
+	case a < 0:
+		return 1
+	case b < 0:
+		return -1
+	}
+	return compareInts(a, b)
+}
+
+func compareBlankLast(a string, b string) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	return naturalCompare(a, b)
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// naturalCompare compares strings case-insensitively, treating runs of digits
+// as numbers so "Splash 2" sorts before "Splash 10".
+func naturalCompare(a string, b string) int {
+	ar := []rune(strings.ToLower(a))
+	br := []rune(strings.ToLower(b))
+	i, j := 0, 0
+	for i < len(ar) && j < len(br) {
+		if unicode.IsDigit(ar[i]) && unicode.IsDigit(br[j]) {
+			startA, startB := i, j
+			for i < len(ar) && unicode.IsDigit(ar[i]) {
+				i++
+			}
+			for j < len(br) && unicode.IsDigit(br[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(string(ar[startA:i]), "0")
+			numB := strings.TrimLeft(string(br[startB:j]), "0")
+			if c := compareInts(len(numA), len(numB)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(numA, numB); c != 0 {
+				return c
+			}
+			continue
+		}
+		if ar[i] != br[j] {
+			return compareInts(int(ar[i]), int(br[j]))
+		}
+		i++
+		j++
+	}
+	return compareInts(len(ar)-i, len(br)-j)
+}
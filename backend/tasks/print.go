@@ -0,0 +1,311 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type PageOrientation string
+
+const (
+	OrientationDefault   PageOrientation = ""
+	OrientationPortrait  PageOrientation = "portrait"
+	OrientationLandscape PageOrientation = "landscape"
+)
+
+type PageBreakMode string
+
+const (
+	PageBreaksNone PageBreakMode = ""
+	// PageBreaksTime starts a new printed page at each new class time.
+	PageBreaksTime PageBreakMode = "time"
+	// PageBreaksInstructor starts a new printed page at each new instructor,
+	// which is most useful with SortByInstructor.
+	PageBreaksInstructor PageBreakMode = "instructor"
+)
+
+// maxSessionNameLength keeps the page header inside Excel's 255 character
+// limit for header and footer text.
+const maxSessionNameLength = 100
+
+// ParsePageOrientation accepts "portrait" and "landscape"; empty keeps
+// Excel's default.
+func ParsePageOrientation(value string) (PageOrientation, bool) {
+	switch orientation := PageOrientation(strings.ToLower(strings.TrimSpace(value))); orientation {
+	case OrientationDefault, OrientationPortrait, OrientationLandscape:
+		return orientation, true
+	}
+	return OrientationDefault, false
+}
+
+// ParsePageBreaks accepts "time" and "instructor"; empty and "none" mean no
+// manual page breaks.
+func ParsePageBreaks(value string) (PageBreakMode, bool) {
+	switch mode := PageBreakMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case PageBreaksNone, "none":
+		return PageBreaksNone, true
+	case PageBreaksTime, PageBreaksInstructor:
+		return mode, true
+	}
+	return PageBreaksNone, false
+}
+
+// setMasterListPrintSetup applies the page setup chosen in options to a
+// masterlist sheet of the given size. It must run before the sheet is
+// streamed, since the stream writer copies these settings when it starts.
+func setMasterListPrintSetup(file *excelize.File, sheet string, columns int, rows int, options FormatOptions) error {
+	lastCell, err := excelize.CoordinatesToCellName(columns, rows)
+	if err != nil {
+		return err
+	}
+	if options.AutoFilter {
+		if err := file.AutoFilter(sheet, "A1:"+lastCell, nil); err != nil {
+			return err
+		}
+	}
+
+	layout := &excelize.PageLayoutOptions{}
+	if options.Orientation != OrientationDefault {
+		orientation := string(options.Orientation)
+		layout.Orientation = &orientation
+	}
+	if options.FitToWidth {
+		width, height := 1, 0
+		layout.FitToWidth, layout.FitToHeight = &width, &height
+		fit := true
+		if err := file.SetSheetProps(sheet, &excelize.SheetPropsOptions{FitToPage: &fit}); err != nil {
+			return err
+		}
+	}
+	if err := file.SetPageLayout(sheet, layout); err != nil {
+		return err
+	}
+
+	if options.RepeatHeader {
+		err := file.SetDefinedName(&excelize.DefinedName{
+			Name:     "_xlnm.Print_Titles",
+			RefersTo: fmt.Sprintf("'%s'!$1:$1", strings.ReplaceAll(sheet, "'", "''")),
+			Scope:    sheet,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.HeaderFooter {
+		header := ""
+		if name := strings.TrimSpace(options.SessionName); name != "" {
+			if runes := []rune(name); len(runes) > maxSessionNameLength {
+				name = string(runes[:maxSessionNameLength])
+			}
+			header = "&C&B" + strings.ReplaceAll(name, "&", "&&")
+		}
+		err := file.SetHeaderFooter(sheet, &excelize.HeaderFooterOptions{
+			OddHeader: header,
+			OddFooter: "&LPrinted &D&RPage &P of &N",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageBreakRows returns the sheet rows that start a new time or instructor
+// block, each of which gets a manual page break above it. Header rows belong
+// to the block of the students below them, and total rows to the block above.
+func pageBreakRows(rows []MasterListRow, firstRow int, mode PageBreakMode) []int {
+	blockKey := func(row MasterListRow) string {
+		if mode == PageBreaksInstructor {
+			return strings.ToLower(row.Instructor)
+		}
+		return row.Time
+	}
+	if mode == PageBreaksNone {
+		return nil
+	}
+
+	breaks := []int{}
+	previous := ""
+	blockStart := -1
+	seen := false
+	for i, row := range rows {
+		if row.Kind == MasterListTotalRow {
+			// Totals stay with the block they count.
+			continue
+		}
+		if blockStart < 0 {
+			blockStart = i
+		}
+		if row.Kind != MasterListStudentRow {
+			continue
+		}
+		key := blockKey(row)
+		if seen && key != previous {
+			breaks = append(breaks, firstRow+blockStart)
+		}
+		previous, seen = key, true
+		blockStart = -1
+	}
+	return breaks
+}
+
+type PaperSize string
+
+const (
+	PaperDefault PaperSize = ""
+	PaperLetter  PaperSize = "letter"
+	PaperLegal   PaperSize = "legal"
+	PaperTabloid PaperSize = "tabloid"
+	PaperA4      PaperSize = "a4"
+	PaperA3      PaperSize = "a3"
+)
+
+// paperSizes holds the portrait width and height of each paper size in
+// inches.
+var paperSizes = map[PaperSize][2]float64{
+	PaperLetter:  {8.5, 11},
+	PaperLegal:   {8.5, 14},
+	PaperTabloid: {11, 17},
+	PaperA4:      {8.27, 11.69},
+	PaperA3:      {11.69, 16.54},
+}
+
+// ParsePaperSize accepts the PaperSize names; empty keeps the default.
+func ParsePaperSize(value string) (PaperSize, bool) {
+	size := PaperSize(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := paperSizes[size]; ok || size == PaperDefault {
+		return size, true
+	}
+	return PaperDefault, false
+}
+
+// Default PDF page setup, matching the masterlist PDF before it could be
+// configured.
+const (
+	DefaultPDFMargin   = 0.35
+	DefaultPDFFontSize = 9.0
+	DefaultPDFScale    = 0.9
+)
+
+// PDFHeaderFooterMargin is the least top and bottom margin, in inches, that
+// leaves room for the running header and footer.
+const PDFHeaderFooterMargin = 0.5
+
+// PDFPageSetup is the page setup of a masterlist PDF. Zero values and a nil
+// Margin fall back to the defaults: Letter paper, 0.35in margins and 9px text
+// at 90% scale.
+type PDFPageSetup struct {
+	PaperSize PaperSize `json:"paper_size,omitempty"`
+	// Margin is in inches, and may be 0; FontSize is in CSS pixels.
+	Margin   *float64 `json:"margin,omitempty"`
+	FontSize float64  `json:"font_size,omitempty"`
+	Scale    float64  `json:"scale,omitempty"`
+}
+
+// Validate checks that each value set is one Chrome can print.
+func (p PDFPageSetup) Validate() error {
+	if _, ok := ParsePaperSize(string(p.PaperSize)); !ok {
+		return fmt.Errorf("invalid paper_size; use letter, legal, tabloid, a4 or a3")
+	}
+	if p.Margin != nil && (*p.Margin < 0 || *p.Margin > 2) {
+		return fmt.Errorf("invalid margin; use 0 to 2 inches")
+	}
+	if p.FontSize != 0 && (p.FontSize < 5 || p.FontSize > 24) {
+		return fmt.Errorf("invalid font_size; use 5 to 24")
+	}
+	if p.Scale != 0 && (p.Scale < 0.1 || p.Scale > 2) {
+		return fmt.Errorf("invalid scale; use 0.1 to 2")
+	}
+	return nil
+}
+
+// WithDefaults fills the values left unset from defaults, then from the
+// built-in defaults.
+func (p PDFPageSetup) WithDefaults(defaults PDFPageSetup) PDFPageSetup {
+	margin := DefaultPDFMargin
+	for _, fallback := range []PDFPageSetup{defaults, {PaperLetter, &margin, DefaultPDFFontSize, DefaultPDFScale}} {
+		if p.PaperSize == PaperDefault {
+			p.PaperSize = fallback.PaperSize
+		}
+		if p.Margin == nil && fallback.Margin != nil {
+			value := *fallback.Margin
+			p.Margin = &value
+		}
+		if p.FontSize == 0 {
+			p.FontSize = fallback.FontSize
+		}
+		if p.Scale == 0 {
+			p.Scale = fallback.Scale
+		}
+	}
+	return p
+}
+
+// PageInches returns the width and height of the page in inches, turned for
+// landscape.
+func (p PDFPageSetup) PageInches(orientation PageOrientation) (float64, float64) {
+	size, ok := paperSizes[p.PaperSize]
+	if !ok {
+		size = paperSizes[PaperLetter]
+	}
+	if orientation == OrientationLandscape {
+		return size[1], size[0]
+	}
+	return size[0], size[1]
+}
+
+// Margins returns the side and the top and bottom margins in inches, widened
+// for the running header and footer when headerFooter is set.
+func (p PDFPageSetup) Margins(headerFooter bool) (float64, float64) {
+	margin := DefaultPDFMargin
+	if p.Margin != nil {
+		margin = *p.Margin
+	}
+	vertical := margin
+	if headerFooter && vertical < PDFHeaderFooterMargin {
+		vertical = PDFHeaderFooterMargin
+	}
+	return margin, vertical
+}
+
+// MasterListPageGroup is a run of masterlist rows that a printed page keeps
+// together: a class with the time and course headers above it and the total
+// rows below it.
+type MasterListPageGroup struct {
+	Rows []MasterListRow
+	// Break reports whether the group starts a new page under the page break
+	// mode the groups were split with.
+	Break bool
+}
+
+// MasterListPageGroups splits rows into page groups. A group starts at the
+// first of a run of header rows, or at a student of a new class when there
+// are no course headers.
+func MasterListPageGroups(rows []MasterListRow, mode PageBreakMode) []MasterListPageGroup {
+	breaks := map[int]bool{}
+	for _, row := range pageBreakRows(rows, 0, mode) {
+		breaks[row] = true
+	}
+
+	groups := []MasterListPageGroup{}
+	for i, row := range rows {
+		start := i == 0
+		if i > 0 {
+			previous := rows[i-1]
+			switch row.Kind {
+			case MasterListTimeHeader, MasterListCourseHeader:
+				start = previous.Kind != MasterListTimeHeader && previous.Kind != MasterListCourseHeader
+			case MasterListStudentRow:
+				start = previous.Kind == MasterListTotalRow || previous.Kind == MasterListStudentRow && previous.Code != row.Code
+			}
+		}
+		if start {
+			groups = append(groups, MasterListPageGroup{Break: breaks[i]})
+		}
+		groups[len(groups)-1].Rows = append(groups[len(groups)-1].Rows, row)
+	}
+	return groups
+}
@@ -0,0 +1,356 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type ImportField string
+
+const (
+	FieldCode             ImportField = "code"
+	FieldServiceName      ImportField = "serviceName"
+	FieldDay              ImportField = "day"
+	FieldTime             ImportField = "time"
+	FieldLocation         ImportField = "location"
+	FieldSchedule         ImportField = "schedule"
+	FieldPhone            ImportField = "phone"
+	FieldName             ImportField = "name"
+	FieldFirstName        ImportField = "firstName"
+	FieldLastName         ImportField = "lastName"
+	FieldPreferredName    ImportField = "preferredName"
+	FieldBirthdate        ImportField = "birthdate"
+	FieldAge              ImportField = "age"
+	FieldGuardian         ImportField = "guardian"
+	FieldMedicalAlerts    ImportField = "medicalAlerts"
+	FieldAllergies        ImportField = "allergies"
+	FieldInclusionSupport ImportField = "inclusionSupport"
+	FieldCapacity         ImportField = "capacity"
+)
+
+type NameFormat string
+
+const (
+	// NameFormatAuto flips "Last, First" names and falls back to the
+	// first/last name columns when the full name column is blank.
+	NameFormatAuto      NameFormat = "auto"
+	NameFormatLastFirst NameFormat = "last_first"
+	NameFormatFirstLast NameFormat = "first_last"
+	NameFormatSplit     NameFormat = "split"
+)
+
+type DayFormat string
+
+const (
+	DayFormatAuto     DayFormat = "auto"
+	DayFormatSchedule DayFormat = "schedule"
+)
+
+const DefaultImportProfile = "generic"
+
+var ErrUnknownProfile = errors.New("unknown import profile")
+
+type ImportProfile struct {
+	Name       string                   `json:"name"`
+	Label      string                   `json:"label"`
+	Signature  []string                 `json:"signature"`
+	Columns    map[ImportField][]string `json:"columns"`
+	NameFormat NameFormat               `json:"nameFormat"`
+	DayFormat  DayFormat                `json:"dayFormat"`
+}
+
+var importProfiles = []ImportProfile{
+	{
+		Name:      "series",
+		Label:     "Registration export (series)",
+		Signature: []string{"EventID", "EventSchedule", "ServiceName"},
+		Columns: map[ImportField][]string{
+			FieldCode:             {"EventID", "Event Id", "ClassCode", "Code"},
+			FieldServiceName:      {"ServiceName", "Service", "Service Name"},
+			FieldDay:              {"Day", "DayOfWeek"},
+			FieldTime:             {"EventTime", "Time"},
+			FieldLocation:         {"Location", "Facility"},
+			FieldSchedule:         {"EventSchedule", "Schedule"},
+			FieldPhone:            {"AttendeePhone", "Phone"},
+			FieldName:             {"AttendeeName", "Name"},
+			FieldFirstName:        {"AttendeeFirstName", "FirstName", "First Name"},
+			FieldLastName:         {"AttendeeLastName", "LastName", "Last Name"},
+			FieldPreferredName:    {"AttendeePreferredName", "PreferredName", "Preferred Name", "Nickname"},
+			FieldBirthdate:        {"AttendeeBirthDate", "AttendeeDOB", "BirthDate", "Birthdate", "Date of Birth", "DOB"},
+			FieldAge:              {"AttendeeAge", "Age"},
+			FieldGuardian:         {"GuardianName", "Guardian", "Parent/Guardian", "ParentName", "Parent Name"},
+			FieldMedicalAlerts:    {"MedicalAlerts", "Medical Alerts", "MedicalConditions", "Medical Conditions", "Medical"},
+			FieldAllergies:        {"Allergies", "Allergy"},
+			FieldInclusionSupport: {"InclusionSupport", "Inclusion Support", "Accommodations"},
+			FieldCapacity:         {"Capacity", "MaxEnrollment", "Max Enrollment", "EventCapacity", "MaxAttendees"},
+		},
+		NameFormat: NameFormatAuto,
+		DayFormat:  DayFormatAuto,
+	},
+	{
+		Name:      "program",
+		Label:     "Registration export (program)",
+		Signature: []string{"EventID", "Service", "AttendeeName"},
+		Columns: map[ImportField][]string{
+			FieldCode:             {"EventID", "Event Id", "ClassCode", "Code"},
+			FieldServiceName:      {"Service", "ServiceName", "Service Name"},
+			FieldDay:              {"Day", "DayOfWeek"},
+			FieldTime:             {"EventTime", "Time"},
+			FieldLocation:         {"Location", "Facility"},
+			FieldSchedule:         {"EventSchedule", "Schedule"},
+			FieldPhone:            {"Phone", "AttendeePhone"},
+			FieldName:             {"AttendeeName", "Name"},
+			FieldFirstName:        {"AttendeeFirstName", "FirstName", "First Name"},
+			FieldLastName:         {"AttendeeLastName", "LastName", "Last Name"},
+			FieldPreferredName:    {"AttendeePreferredName", "PreferredName", "Preferred Name", "Nickname"},
+			FieldBirthdate:        {"AttendeeBirthDate", "AttendeeDOB", "BirthDate", "Birthdate", "Date of Birth", "DOB"},
+			FieldAge:              {"AttendeeAge", "Age"},
+			FieldGuardian:         {"GuardianName", "Guardian", "Parent/Guardian", "ParentName", "Parent Name"},
+			FieldMedicalAlerts:    {"MedicalAlerts", "Medical Alerts", "MedicalConditions", "Medical Conditions", "Medical"},
+			FieldAllergies:        {"Allergies", "Allergy"},
+			FieldInclusionSupport: {"InclusionSupport", "Inclusion Support", "Accommodations"},
+			FieldCapacity:         {"Capacity", "MaxEnrollment", "Max Enrollment", "EventCapacity", "MaxAttendees"},
+		},
+		NameFormat: NameFormatAuto,
+		DayFormat:  DayFormatAuto,
+	},
+	{
+		Name:  DefaultImportProfile,
+		Label: "Generic roster",
+		Columns: map[ImportField][]string{
+			FieldCode:             {"EventID", "Event Id", "ClassCode", "Code"},
+			FieldServiceName:      {"ServiceName", "Service", "Service Name"},
+			FieldDay:              {"Day", "DayOfWeek"},
+			FieldTime:             {"EventTime", "Time"},
+			FieldLocation:         {"Location", "Facility"},
+			FieldSchedule:         {"EventSchedule", "Schedule"},
+			FieldPhone:            {"AttendeePhone", "Phone"},
+			FieldName:             {"AttendeeName", "Name"},
+			FieldFirstName:        {"FirstName", "First Name"},
+			FieldLastName:         {"LastName", "Last Name"},
+			FieldPreferredName:    {"PreferredName", "Preferred Name", "Nickname", "Nick Name"},
+			FieldBirthdate:        {"AttendeeBirthDate", "AttendeeDOB", "BirthDate", "Birthdate", "Date of Birth", "DOB"},
+			FieldAge:              {"AttendeeAge", "Age"},
+			FieldGuardian:         {"GuardianName", "Guardian", "Parent/Guardian", "ParentName", "Parent Name"},
+			FieldMedicalAlerts:    {"MedicalAlerts", "Medical Alerts", "MedicalConditions", "Medical Conditions", "Medical"},
+			FieldAllergies:        {"Allergies", "Allergy"},
+			FieldInclusionSupport: {"InclusionSupport", "Inclusion Support", "Accommodations"},
+			FieldCapacity:         {"Capacity", "MaxEnrollment", "Max Enrollment", "EventCapacity", "MaxAttendees"},
+		},
+		NameFormat: NameFormatAuto,
+		DayFormat:  DayFormatAuto,
+	},
+}
+
+func ImportProfiles() []ImportProfile {
+	profiles := make([]ImportProfile, len(importProfiles))
+	copy(profiles, importProfiles)
+	return profiles
+}
+
+func LookupImportProfile(name string) (ImportProfile, bool) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	for _, profile := range importProfiles {
+		if strings.ToLower(profile.Name) == key {
+			return profile, true
+		}
+	}
+	return ImportProfile{}, false
+}
+
+// SelectImportProfile returns the named profile when one is requested and
+// otherwise detects the best match for the header row.
+func SelectImportProfile(name string, headers []string) (ImportProfile, error) {
+	if strings.TrimSpace(name) != "" {
+		profile, ok := LookupImportProfile(name)
+		if !ok {
+			return ImportProfile{}, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+		}
+		return profile, nil
+	}
+	return DetectImportProfile(headers), nil
+}
+
+func DetectImportProfile(headers []string) ImportProfile {
+	present := map[string]bool{}
+	for _, header := range headers {
+		if normalized := normalizeHeader(header); normalized != "" {
+			present[normalized] = true
+		}
+	}
+
+	best := -1
+	bestScore := 0
+	for i, profile := range importProfiles {
+		if len(profile.Signature) == 0 {
+			continue
+		}
+		matched := true
+		for _, header := range profile.Signature {
+			if !present[normalizeHeader(header)] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		score := 0
+		for _, aliases := range profile.Columns {
+			for _, alias := range aliases {
+				if present[normalizeHeader(alias)] {
+					score++
+					break
+				}
+			}
+		}
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+
+	if best >= 0 {
+		return importProfiles[best]
+	}
+	profile, _ := LookupImportProfile(DefaultImportProfile)
+	return profile
+}
+
+// LoadImportProfiles reads a JSON array of profiles and registers them ahead
+// of the built-in ones. A profile with a built-in name replaces it.
+func LoadImportProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var loaded []ImportProfile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("parse import profiles: %w", err)
+	}
+
+	custom := make([]ImportProfile, 0, len(loaded))
+	names := map[string]bool{}
+	for i, profile := range loaded {
+		profile.Name = strings.TrimSpace(profile.Name)
+		if profile.Name == "" {
+			return fmt.Errorf("import profile %d: missing name", i+1)
+		}
+		if len(profile.Columns[FieldCode]) == 0 {
+			return fmt.Errorf("import profile %q: missing %s column", profile.Name, FieldCode)
+		}
+		if len(profile.Columns[FieldName]) == 0 && len(profile.Columns[FieldLastName]) == 0 {
+			return fmt.Errorf("import profile %q: missing %s column", profile.Name, FieldName)
+		}
+		if profile.NameFormat == "" {
+			profile.NameFormat = NameFormatAuto
+		}
+		if profile.DayFormat == "" {
+			profile.DayFormat = DayFormatAuto
+		}
+		names[strings.ToLower(profile.Name)] = true
+		custom = append(custom, profile)
+	}
+
+	for _, profile := range importProfiles {
+		if !names[strings.ToLower(profile.Name)] {
+			custom = append(custom, profile)
+		}
+	}
+	importProfiles = custom
+	return nil
+}
+
+type profileColumns map[ImportField]int
+
+func (p ImportProfile) columnIndex(headers []string) profileColumns {
+	headerIndex := map[string]int{}
+	for i, header := range headers {
+		normalized := normalizeHeader(header)
+		if normalized == "" {
+			continue
+		}
+		headerIndex[normalized] = i
+	}
+
+	columns := profileColumns{}
+	for field, aliases := range p.Columns {
+		for _, alias := range aliases {
+			if idx, ok := headerIndex[normalizeHeader(alias)]; ok {
+				columns[field] = idx
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func (c profileColumns) get(row []string, field ImportField) string {
+	idx, ok := c[field]
+	if !ok || idx >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[idx])
+}
+
+func (p ImportProfile) studentName(row []string, columns profileColumns) PersonName {
+	name := columns.get(row, FieldName)
+	split := PersonName{
+		First: normalizeGivenName(columns.get(row, FieldFirstName)),
+		Last:  normalizeSurname(columns.get(row, FieldLastName)),
+	}
+	hasSplit := split.First != "" || split.Last != ""
+
+	var parsed PersonName
+	switch p.NameFormat {
+	case NameFormatSplit:
+		if hasSplit || name == "" {
+			parsed = split
+		} else {
+			parsed = SplitName(name)
+		}
+	case NameFormatFirstLast:
+		if name == "" {
+			parsed = split
+		} else {
+			parsed = splitFirstLast(name)
+		}
+	case NameFormatLastFirst:
+		if name == "" {
+			parsed = split
+		} else if strings.Contains(name, ",") {
+			parsed = SplitName(name)
+		} else {
+			parsed = splitLastFirst(name)
+		}
+	default:
+		if name == "" {
+			parsed = split
+		} else {
+			parsed = SplitName(name)
+		}
+	}
+
+	parsed.Preferred = preferredName(parsed.First, normalizeGivenName(columns.get(row, FieldPreferredName)))
+	return parsed
+}
+
+func (p ImportProfile) classDay(row []string, columns profileColumns) string {
+	day := columns.get(row, FieldDay)
+	if day != "" || p.DayFormat != DayFormatSchedule {
+		return day
+	}
+
+	tokens := []string{}
+	for _, token := range strings.Fields(columns.get(row, FieldSchedule)) {
+		if !isDayToken(strings.Trim(token, ",")) {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	return strings.Join(tokens, " ")
+}
@@ -0,0 +1,214 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout      = "2006-01-02"
+	maxMeetingDates = 370
+)
+
+var (
+	numericDatePattern = regexp.MustCompile(`\b(\d{1,4})[/-](\d{1,2})[/-](\d{2,4})\b`)
+	namedDatePattern   = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+	monthNumbers       = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+		"sep": time.September, "sept": time.September, "oct": time.October,
+		"nov": time.November, "dec": time.December,
+	}
+)
+
+// ClassSchedule is the parsed form of a class's EventTime and EventSchedule.
+// Times are minutes after midnight; dates use the 2006-01-02 layout.
+type ClassSchedule struct {
+	HasTime         bool     `json:"hasTime"`
+	Start           string   `json:"start,omitempty"`
+	End             string   `json:"end,omitempty"`
+	StartMinutes    int      `json:"startMinutes"`
+	EndMinutes      int      `json:"endMinutes"`
+	DurationMinutes int      `json:"durationMinutes"`
+	Weekdays        []string `json:"weekdays"`
+	FirstDate       string   `json:"firstDate,omitempty"`
+	LastDate        string   `json:"lastDate,omitempty"`
+	Dates           []string `json:"dates,omitempty"`
+}
+
+// ParseSchedule combines the time, day and schedule columns of an export into
+// a ClassSchedule. Fields that cannot be parsed are left empty.
+func ParseSchedule(timeValue string, day string, schedule string) ClassSchedule {
+	parsed := ClassSchedule{Weekdays: []string{}}
+
+	start, end, ok := parseTimeRange(timeValue)
+	if !ok {
+		start, end, ok = findTimeRange(schedule)
+	}
+	if ok {
+		if end < start {
+			end = start
+		}
+		parsed.HasTime = true
+		parsed.StartMinutes = start
+		parsed.EndMinutes = end
+		parsed.DurationMinutes = end - start
+		parsed.Start = formatMinutes(start)
+		parsed.End = formatMinutes(end)
+	}
+
+	parsed.Weekdays = scheduleWeekdays(day, schedule)
+
+	dates := findDates(schedule)
+	if len(dates) == 0 {
+		return parsed
+	}
+	first := dates[0]
+	last := dates[len(dates)-1]
+	if last.Before(first) {
+		first, last = last, first
+	}
+	parsed.FirstDate = first.Format(dateLayout)
+	parsed.LastDate = last.Format(dateLayout)
+
+	if len(parsed.Weekdays) == 0 {
+		parsed.Weekdays = []string{weekdayCode(first.Weekday())}
+	}
+	meets := map[string]bool{}
+	for _, weekday := range parsed.Weekdays {
+		meets[weekday] = true
+	}
+	for current, count := first, 0; !current.After(last) && count < maxMeetingDates; current, count = current.AddDate(0, 0, 1), count+1 {
+		if meets[weekdayCode(current.Weekday())] {
+			parsed.Dates = append(parsed.Dates, current.Format(dateLayout))
+		}
+	}
+	return parsed
+}
+
+// ParsedSchedule returns the parsed schedule for the roster, parsing the raw
+// strings when the roster did not come from ProcessCSV.
+func (r ClassRoster) ParsedSchedule() ClassSchedule {
+	if r.Timing != nil {
+		return *r.Timing
+	}
+	return ParseSchedule(r.Time, r.Day, r.Schedule)
+}
+
+func (s ClassSchedule) FirstMeeting() (time.Time, bool) {
+	if s.FirstDate == "" {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(dateLayout, s.FirstDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func findTimeRange(value string) (int, int, bool) {
+	fields := strings.Fields(value)
+	for i := range fields {
+		for j := len(fields); j > i; j-- {
+			candidate := strings.Join(fields[i:j], " ")
+			if !strings.ContainsAny(candidate, ":") {
+				continue
+			}
+			if start, end, ok := parseTimeRange(candidate); ok {
+				return start, end, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func scheduleWeekdays(day string, schedule string) []string {
+	if days, ok := ParseDays(day); ok {
+		return days
+	}
+
+	tokens := []string{}
+	for _, token := range strings.Fields(schedule) {
+		if !isDayToken(strings.Trim(token, ",")) {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	if days, ok := ParseDays(strings.Join(tokens, " ")); ok {
+		return days
+	}
+	return []string{}
+}
+
+func weekdayCode(weekday time.Weekday) string {
+	return [...]string{"Su", "Mo", "Tu", "We", "Th", "Fr", "Sa"}[weekday]
+}
+
+func findDates(value string) []time.Time {
+	type found struct {
+		offset int
+		date   time.Time
+	}
+	matches := []found{}
+
+	for _, match := range numericDatePattern.FindAllStringSubmatchIndex(value, -1) {
+		a, _ := strconv.Atoi(value[match[2]:match[3]])
+		b, _ := strconv.Atoi(value[match[4]:match[5]])
+		c, _ := strconv.Atoi(value[match[6]:match[7]])
+		if date, ok := numericDate(a, b, c, match[3]-match[2]); ok {
+			matches = append(matches, found{offset: match[0], date: date})
+		}
+	}
+	for _, match := range namedDatePattern.FindAllStringSubmatchIndex(value, -1) {
+		month := monthNumbers[strings.ToLower(value[match[2]:match[3]])]
+		dayOfMonth, _ := strconv.Atoi(value[match[4]:match[5]])
+		year, _ := strconv.Atoi(value[match[6]:match[7]])
+		if date, ok := buildDate(year, month, dayOfMonth); ok {
+			matches = append(matches, found{offset: match[0], date: date})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].offset < matches[j].offset
+	})
+	dates := make([]time.Time, 0, len(matches))
+	for _, match := range matches {
+		dates = append(dates, match.date)
+	}
+	return dates
+}
+
+// numericDate reads year-first dates as Y-M-D and everything else as M/D/Y,
+// switching to D/M/Y when the first number cannot be a month.
+func numericDate(a, b, c int, firstWidth int) (time.Time, bool) {
+	if firstWidth == 4 {
+		return buildDate(a, time.Month(b), c)
+	}
+	year := c
+	if year < 100 {
+		year += 2000
+	}
+	if a > 12 {
+		return buildDate(year, time.Month(b), a)
+	}
+	return buildDate(year, time.Month(a), b)
+}
+
+func buildDate(year int, month time.Month, day int) (time.Time, bool) {
+	if month < time.January || month > time.December || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != month {
+		return time.Time{}, false
+	}
+	return date, true
+}
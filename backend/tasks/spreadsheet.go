@@ -0,0 +1,127 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const headerScanRows = 20
+
+// spreadsheetMemoryBytes is the largest unzipped worksheet read into memory;
+// larger sheets are unzipped to a temporary file and streamed from there.
+const spreadsheetMemoryBytes = 4 << 20
+
+// SpreadsheetRows streams the rows of one worksheet.
+type SpreadsheetRows struct {
+	file *excelize.File
+	rows *excelize.Rows
+	row  int
+}
+
+// OpenSpreadsheetRows opens an .xlsx workbook and returns a reader over the
+// selected sheet, or the active sheet when none is requested.
+func OpenSpreadsheetRows(reader io.Reader, sheetName string) (*SpreadsheetRows, error) {
+	file, err := excelize.OpenReader(reader, excelize.Options{UnzipXMLSizeLimit: spreadsheetMemoryBytes})
+	if err != nil {
+		return nil, fmt.Errorf("open workbook: %w", err)
+	}
+
+	sheet, err := selectSheet(file, sheetName)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read sheet %q: %w", sheet, err)
+	}
+	return &SpreadsheetRows{file: file, rows: rows}, nil
+}
+
+func (s *SpreadsheetRows) Read() ([]string, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	s.row++
+	return s.rows.Columns()
+}
+
+func (s *SpreadsheetRows) RowNumber() int {
+	return s.row
+}
+
+func (s *SpreadsheetRows) Close() error {
+	s.rows.Close()
+	return s.file.Close()
+}
+
+func selectSheet(file *excelize.File, requested string) (string, error) {
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		active := file.GetActiveSheetIndex()
+		if active >= 0 && active < len(sheets) {
+			return sheets[active], nil
+		}
+		return sheets[0], nil
+	}
+
+	for _, sheet := range sheets {
+		if strings.EqualFold(sheet, requested) {
+			return sheet, nil
+		}
+	}
+	if index, err := strconv.Atoi(requested); err == nil && index >= 1 && index <= len(sheets) {
+		return sheets[index-1], nil
+	}
+	return "", fmt.Errorf("sheet %q not found; available sheets: %s", requested, strings.Join(sheets, ", "))
+}
+
+// DetectHeaderRow returns the 0-based index of the row within the first few
+// rows that matches the most known column names.
+func DetectHeaderRow(records [][]string) int {
+	known := map[string]bool{}
+	for _, profile := range importProfiles {
+		for _, aliases := range profile.Columns {
+			for _, alias := range aliases {
+				known[normalizeHeader(alias)] = true
+			}
+		}
+	}
+
+	best := 0
+	bestScore := 0
+	for i, row := range records {
+		if i >= headerScanRows {
+			break
+		}
+		score := 0
+		for _, cell := range row {
+			if known[normalizeHeader(cell)] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+
+	if bestScore < 2 {
+		return 0
+	}
+	return best
+}
@@ -0,0 +1,124 @@
+package tasks
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyAlertValues are placeholder answers registration forms use for "no
+// medical alert".
+var emptyAlertValues = map[string]bool{
+	"none": true, "n/a": true, "na": true, "no": true, "nil": true, "-": true,
+	"none known": true, "nka": true, "nkda": true,
+}
+
+// studentDetails holds the optional, sensitive student fields. They are always
+// parsed into the roster JSON but only printed when asked for.
+type studentDetails struct {
+	Birthdate     string
+	Age           *int
+	Guardian      string
+	MedicalAlerts []string
+}
+
+// readStudentDetails parses the optional detail columns of a row. Age is
+// computed as of sessionStart, falling back to an age column when there is no
+// usable birthdate. bad is the birthdate value when it could not be parsed.
+func readStudentDetails(row []string, columns profileColumns, sessionStart time.Time) (details studentDetails, bad string) {
+	details.Guardian = NormalizeName(columns.get(row, FieldGuardian))
+	details.MedicalAlerts = medicalAlerts(row, columns)
+
+	if value := columns.get(row, FieldBirthdate); value != "" {
+		if birthdate, ok := parseBirthdate(value, sessionStart); ok {
+			details.Birthdate = birthdate.Format(dateLayout)
+			age := AgeOn(birthdate, sessionStart)
+			details.Age = &age
+			return details, ""
+		}
+		bad = value
+	}
+	if value := columns.get(row, FieldAge); value != "" {
+		if age, err := strconv.Atoi(strings.Fields(value)[0]); err == nil && age >= 0 {
+			details.Age = &age
+		}
+	}
+	return details, bad
+}
+
+func medicalAlerts(row []string, columns profileColumns) []string {
+	alerts := []string{}
+	for _, source := range []struct {
+		field ImportField
+		label string
+	}{
+		{FieldMedicalAlerts, ""},
+		{FieldAllergies, "Allergies"},
+		{FieldInclusionSupport, "Inclusion support"},
+	} {
+		value := strings.Join(strings.Fields(columns.get(row, source.field)), " ")
+		if value == "" || emptyAlertValues[strings.ToLower(strings.TrimRight(value, "."))] {
+			continue
+		}
+		if source.label != "" {
+			value = source.label + ": " + value
+		}
+		alerts = append(alerts, value)
+	}
+	return alerts
+}
+
+// parseBirthdate reads a date of birth in any format findDates accepts. Two
+// digit years that would put the birthdate after the session are moved back a
+// century.
+func parseBirthdate(value string, sessionStart time.Time) (time.Time, bool) {
+	dates := findDates(value)
+	if len(dates) == 0 {
+		return time.Time{}, false
+	}
+	birthdate := dates[0]
+	if birthdate.After(sessionStart) {
+		birthdate = birthdate.AddDate(-100, 0, 0)
+	}
+	return birthdate, true
+}
+
+// AgeOn returns the age in whole years of someone born on birthdate as of the
+// given day.
+func AgeOn(birthdate time.Time, day time.Time) int {
+	age := day.Year() - birthdate.Year()
+	if day.Month() < birthdate.Month() || (day.Month() == birthdate.Month() && day.Day() < birthdate.Day()) {
+		age--
+	}
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// sessionStartFor picks the date ages are computed on: the session start when
+// one was given, otherwise the class's first meeting, otherwise today.
+func sessionStartFor(sessionStart time.Time, timing ClassSchedule) time.Time {
+	if !sessionStart.IsZero() {
+		return sessionStart
+	}
+	if first, ok := timing.FirstMeeting(); ok {
+		return first
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ParseSessionStart reads a session start date such as "2025-07-05" or
+// "7/5/2025".
+func ParseSessionStart(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, true
+	}
+	dates := findDates(value)
+	if len(dates) == 0 {
+		return time.Time{}, false
+	}
+	return dates[0], true
+}
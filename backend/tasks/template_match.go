@@ -0,0 +1,257 @@
+package tasks
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TemplateAlias maps a level name as it appears in exports to the template
+// it prints on.
+type TemplateAlias struct {
+	Alias    string `json:"alias"`
+	Template string `json:"template"`
+}
+
+// DefaultTemplateAliases cover level names that share no words with their
+// template. Saved aliases take precedence.
+var DefaultTemplateAliases = []TemplateAlias{
+	{Alias: "Rookie Patrol", Template: "Splash7"},
+	{Alias: "Ranger Patrol", Template: "Splash8"},
+	{Alias: "Star Patrol", Template: "Splash9"},
+	{Alias: "Private", Template: "SplashPrivate"},
+	{Alias: "Semi Private", Template: "SplashPrivate"},
+	{Alias: "Splash Adult 1", Template: "TeenAdult1"},
+	{Alias: "Splash Adult 2", Template: "TeenAdult2"},
+	{Alias: "Splash Adult 3", Template: "TeenAdult3"},
+	{Alias: "Swim Fitness", Template: "SplashFitness"},
+}
+
+type TemplateMatchRule string
+
+const (
+	TemplateMatchAlias    TemplateMatchRule = "alias"
+	TemplateMatchExact    TemplateMatchRule = "exact"
+	TemplateMatchPrefix   TemplateMatchRule = "prefix"
+	TemplateMatchContains TemplateMatchRule = "contains"
+	TemplateMatchFuzzy    TemplateMatchRule = "fuzzy"
+	// TemplateMatchFallback means nothing matched and the default template
+	// was used instead.
+	TemplateMatchFallback TemplateMatchRule = "fallback"
+)
+
+// TemplateMatch reports the template chosen for a roster and why.
+type TemplateMatch struct {
+	Template string            `json:"template"`
+	Rule     TemplateMatchRule `json:"rule"`
+	// Source is the text that matched: the level, the service name or the
+	// requested template.
+	Source   string `json:"source,omitempty"`
+	Fallback bool   `json:"fallback"`
+}
+
+// templateKey is one way of writing a template's level, as tokens.
+type templateKey struct {
+	template string
+	tokens   []string
+}
+
+// TemplateResolver matches level and service names to attendance templates.
+type TemplateResolver struct {
+	keys    []templateKey
+	aliases []templateKey
+}
+
+// levelStopWords tell no levels apart: "Swim Teen & Adult 2" and "Teen Adult
+// 2" are the same level.
+var levelStopWords = map[string]bool{"and": true, "the": true, "swim": true, "swimming": true, "level": true}
+
+// NewTemplateResolver matches against each template's name and level. aliases
+// are tried before the templates, and earlier aliases win over later ones;
+// aliases naming no template are ignored.
+func NewTemplateResolver(templates []AttendanceTemplate, aliases []TemplateAlias) *TemplateResolver {
+	resolver := &TemplateResolver{}
+	names := map[string]string{}
+	for _, template := range templates {
+		names[strings.ToLower(template.Name)] = template.Name
+		for _, text := range []string{template.Name, template.Level} {
+			if tokens := levelTokens(text); len(tokens) > 0 {
+				resolver.keys = append(resolver.keys, templateKey{template: template.Name, tokens: tokens})
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, alias := range aliases {
+		name, ok := names[strings.ToLower(strings.TrimSpace(alias.Template))]
+		tokens := levelTokens(alias.Alias)
+		if !ok || len(tokens) == 0 || seen[strings.Join(tokens, "")] {
+			continue
+		}
+		seen[strings.Join(tokens, "")] = true
+		resolver.aliases = append(resolver.aliases, templateKey{template: name, tokens: tokens})
+	}
+	return resolver
+}
+
+// Resolve matches the first of values that names a template, such as a
+// level, then a service name. Aliases the value
+// starts with come first, then exact names, names the value starts with or
+// contains, and names spelled a little differently. A value matching two
+// templates equally well matches neither.
+func (r *TemplateResolver) Resolve(values ...string) (TemplateMatch, bool) {
+	for _, value := range values {
+		tokens := levelTokens(value)
+		if len(tokens) == 0 {
+			continue
+		}
+		if template, ok := bestKey(r.aliases, tokens, prefixKey); ok {
+			return TemplateMatch{Template: template, Rule: TemplateMatchAlias, Source: strings.TrimSpace(value)}, true
+		}
+		rules := []struct {
+			rule  TemplateMatchRule
+			match func(tokens []string, key []string) bool
+		}{
+			{TemplateMatchExact, exactKey},
+			{TemplateMatchPrefix, prefixKey},
+			{TemplateMatchContains, containsKey},
+			{TemplateMatchFuzzy, fuzzyKey},
+		}
+		for _, rule := range rules {
+			if template, ok := bestKey(r.keys, tokens, rule.match); ok {
+				return TemplateMatch{Template: template, Rule: rule.rule, Source: strings.TrimSpace(value)}, true
+			}
+		}
+	}
+	return TemplateMatch{}, false
+}
+
+// bestKey returns the template of the longest key that matches tokens. Keys
+// of different templates tied for longest are ambiguous.
+func bestKey(keys []templateKey, tokens []string, match func(tokens []string, key []string) bool) (string, bool) {
+	best, bestLength, ambiguous := "", 0, false
+	for _, key := range keys {
+		if !match(tokens, key.tokens) {
+			continue
+		}
+		length := len(strings.Join(key.tokens, ""))
+		switch {
+		case length > bestLength:
+			best, bestLength, ambiguous = key.template, length, false
+		case length == bestLength && key.template != best:
+			ambiguous = true
+		}
+	}
+	return best, best != "" && !ambiguous
+}
+
+func exactKey(tokens []string, key []string) bool {
+	return strings.Join(tokens, "") == strings.Join(key, "")
+}
+
+// prefixKey matches values that start with the key and go on with more
+// words, as in "Splash 2A - Sat AM".
+func prefixKey(tokens []string, key []string) bool {
+	compact := strings.Join(key, "")
+	for end := 1; end <= len(tokens); end++ {
+		if strings.Join(tokens[:end], "") == compact {
+			return true
+		}
+	}
+	return false
+}
+
+func containsKey(tokens []string, key []string) bool {
+	for start := range tokens {
+		if prefixKey(tokens[start:], key) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyKey matches a run of words spelled within a few letters of the key,
+// such as "Spalsh 3" or "Teens & Adults 1". Numbers must match exactly, so
+// Splash 3 never becomes Splash 8.
+func fuzzyKey(tokens []string, key []string) bool {
+	keyLetters, keyNumbers := splitLevelTokens(key)
+	if len(keyLetters) < 4 {
+		return false
+	}
+	for start := 0; start+len(key) <= len(tokens); start++ {
+		letters, numbers := splitLevelTokens(tokens[start : start+len(key)])
+		if numbers == keyNumbers && editDistance(letters, keyLetters) <= len(keyLetters)/4 {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLevelTokens joins the words and the numbers of tokens separately.
+func splitLevelTokens(tokens []string) (string, string) {
+	var letters, numbers []string
+	for _, token := range tokens {
+		if strings.IndexFunc(token, unicode.IsDigit) >= 0 {
+			numbers = append(numbers, token)
+		} else {
+			letters = append(letters, token)
+		}
+	}
+	return strings.Join(letters, ""), strings.Join(numbers, " ")
+}
+
+// levelTokens lowercases text and splits it into words and numbers, at
+// punctuation and spaces, between a word and a number ("Splash2A" is splash,
+// 2a) and between camel-case words ("TeenAdult" is teen, adult). Stop words
+// are dropped.
+func levelTokens(text string) []string {
+	tokens := []string{}
+	var current []rune
+	flush := func() {
+		if token := strings.ToLower(string(current)); token != "" && !levelStopWords[token] {
+			tokens = append(tokens, token)
+		}
+		current = current[:0]
+	}
+	var previous rune
+	for _, r := range strings.TrimSpace(text) {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case len(current) > 0 && unicode.IsDigit(r) && unicode.IsLetter(previous),
+			len(current) > 0 && unicode.IsUpper(r) && unicode.IsLower(previous):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+		previous = r
+	}
+	flush()
+	return tokens
+}
+
+// editDistance counts the letters inserted, removed, changed or swapped with
+// a neighbour to turn a into b.
+func editDistance(a string, b string) int {
+	x, y := []rune(a), []rune(b)
+	rows := make([][]int, len(x)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(y)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(x)][len(y)]
+}
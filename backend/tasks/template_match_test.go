@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// levelTemplates lists every level of classCapacities in
+// frontend/src/features/schematic/constants.ts with the template it prints
+// on; "" means no template covers the level and it falls back.
+var levelTemplates = map[string]string{
+	"Little Splash 1": "LittleSplash1",
+	"Little Splash 2": "LittleSplash2",
+	"Little Splash 3": "LittleSplash3",
+	"Little Splash 4": "LittleSplash4",
+	"Little Splash 5": "LittleSplash5",
+	"Splash 1":        "Splash1",
+	"Splash 2A":       "Splash2A",
+	"Splash 2B":       "Splash2B",
+	"Splash 3":        "Splash3",
+	"Splash 4":        "Splash4",
+	"Splash 5":        "Splash5",
+	"Splash 6":        "Splash6",
+	"Splash 7":        "Splash7",
+	"Splash 8":        "Splash8",
+	"Splash 9":        "Splash9",
+	"Splash 10":       "",
+	"Splash Adult 1":  "TeenAdult1",
+	"Splash Adult 2":  "TeenAdult2",
+	"Splash Adult 3":  "TeenAdult3",
+	"Inclusion":       "",
+	"Private Lesson":  "SplashPrivate",
+}
+
+func TestTemplateResolverLevels(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "swimming attendance", "*.html"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no attendance templates found: %v", err)
+	}
+	templates := []AttendanceTemplate{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		templates = append(templates, ParseAttendanceTemplate(name, string(content), time.Time{}))
+	}
+	resolver := NewTemplateResolver(templates, DefaultTemplateAliases)
+
+	tests := []struct {
+		level    string
+		template string
+	}{
+		{"Private", "SplashPrivate"},
+		{"Private Lessons", "SplashPrivate"},
+		{"Semi Private", "SplashPrivate"},
+		{"Swim Teen & Adult 2", "TeenAdult2"},
+		{"Parent & Tot 3", "ParentandTot3"},
+		{"Splash Fitness", "SplashFitness"},
+	}
+	for level, template := range levelTemplates {
+		tests = append(tests, struct {
+			level    string
+			template string
+		}{level, template})
+	}
+	for _, test := range tests {
+		match, ok := resolver.Resolve(test.level)
+		if test.template == "" {
+			if ok {
+				t.Errorf("Resolve(%q) = %s, want no template", test.level, match.Template)
+			}
+			continue
+		}
+		if !ok || match.Template != test.template {
+			t.Errorf("Resolve(%q) = %s (%v), want %s", test.level, match.Template, ok, test.template)
+		}
+	}
+}
+
+func TestLevelTemplatesCoverClassCapacities(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("..", "..", "frontend", "src", "features", "schematic", "constants.ts"))
+	if err != nil {
+		t.Skipf("frontend constants not available: %v", err)
+	}
+	block := regexp.MustCompile(`(?s)classCapacities[^{]*\{(.*?)\n\}`).FindSubmatch(content)
+	if block == nil {
+		t.Fatal("classCapacities not found in constants.ts")
+	}
+	for _, match := range regexp.MustCompile(`(?m)^\s*'([^']+)'\s*:`).FindAllSubmatch(block[1], -1) {
+		if _, ok := levelTemplates[string(match[1])]; !ok {
+			t.Errorf("level %q of classCapacities has no expected template", match[1])
+		}
+	}
+}
@@ -0,0 +1,168 @@
+"""Writes the BIFF8 fixtures read by xls_test.go.
+
+excel.xls was saved by Excel and comes from github.com/richardlehane/mscfb
+(Apache License 2.0). The others are built here record by record:
+
+    python3 make_xls.py
+"""
+import struct
+
+BOF, EOF, CONTINUE = 0x0809, 0x000A, 0x003C
+
+
+def rec(kind, data):
+    return struct.pack('<HH', kind, len(data)) + data
+
+
+def xlstr(text, length_bytes=2):
+    try:
+        data, flag = text.encode('latin-1'), 0
+    except UnicodeEncodeError:
+        data, flag = text.encode('utf-16-le'), 1
+    length = struct.pack('<H' if length_bytes == 2 else '<B', len(text))
+    return length + bytes([flag]) + data
+
+
+def bof(kind):
+    return rec(BOF, struct.pack('<HHHHII', 0x0600, kind, 0x0DBB, 0x07CC, 0, 0x06))
+
+
+def xf(number_format):
+    return rec(0x00E0, struct.pack('<HHHBBBBIIH', 0, number_format, 0xFFF5 if number_format == 0 else 1,
+                                   0x20, 0, 0, 0, 0, 0, 0x20C0))
+
+
+def rk_int(value):
+    return (value << 2) | 2
+
+
+def labelsst(row, column, index):
+    return rec(0x00FD, struct.pack('<HHHI', row, column, 0, index))
+
+
+def label(row, column, text):
+    return rec(0x0204, struct.pack('<HHH', row, column, 0) + xlstr(text))
+
+
+def number(row, column, value, xf_index=0):
+    return rec(0x0203, struct.pack('<HHHd', row, column, xf_index, value))
+
+
+def rk(row, column, value, xf_index=0):
+    return rec(0x027E, struct.pack('<HHHI', row, column, xf_index, value))
+
+
+def mulrk(row, column, values):
+    cells = b''.join(struct.pack('<HI', xf_index, value) for xf_index, value in values)
+    return rec(0x00BD, struct.pack('<HH', row, column) + cells + struct.pack('<H', column + len(values) - 1))
+
+
+def formula(row, column, result):
+    return rec(0x0006, struct.pack('<HHH', row, column, 0) + result + struct.pack('<HI', 0, 0) + b'\x00\x00')
+
+
+def string_formula(row, column, text, shared=False):
+    records = formula(row, column, bytes([0, 0, 0, 0, 0, 0, 0xFF, 0xFF]))
+    if shared:
+        # SHRFMLA sits between the first formula of a shared range and its
+        # STRING record.
+        records += rec(0x04BC, struct.pack('<HHBBH', row, row + 1, column, column, 0) + b'\x00\x00')
+    return records + rec(0x0207, xlstr(text))
+
+
+def sheet(cells):
+    return bof(0x0010) + b''.join(cells) + rec(EOF, b'')
+
+
+def embedded_chart():
+    # A chart drawn on a worksheet is a substream of its own; the NUMBER
+    # record in it must not read as a cell.
+    return bof(0x0020) + number(0, 0, 999) + rec(EOF, b'')
+
+
+def shared_strings(strings, split):
+    """An SST whose last string is split into a CONTINUE record after split
+    characters, going on in two-byte characters."""
+    body = b''.join(xlstr(text) for text in strings[:-1])
+    last = strings[-1]
+    head = struct.pack('<II', len(strings), len(strings))
+    first = struct.pack('<H', len(last)) + b'\x00' + last[:split].encode('latin-1')
+    rest = b'\x01' + last[split:].encode('utf-16-le')
+    return rec(0x00FC, head + body + first) + rec(CONTINUE, rest)
+
+
+def workbook(sheets, strings=None, active=0, formats=(), xfs=(0,)):
+    """sheets are (name, type, substream) with type 0 for a worksheet and 2
+    for a chart sheet."""
+    def globals_(offsets):
+        records = bof(0x0005)
+        records += rec(0x003D, struct.pack('<HHHHHHHHH', 0, 0, 100, 100, 0x38, active, 0, 1, 600))
+        records += rec(0x0022, struct.pack('<H', 0))
+        for index, text in formats:
+            records += rec(0x041E, struct.pack('<H', index) + xlstr(text))
+        records += b''.join(xf(number_format) for number_format in xfs)
+        for (name, kind, _), offset in zip(sheets, offsets):
+            records += rec(0x0085, struct.pack('<IBB', offset, 0, kind) + xlstr(name, 1))
+        if strings:
+            records += shared_strings(strings, 20)
+        return records + rec(EOF, b'')
+
+    offsets, position = [], len(globals_([0] * len(sheets)))
+    for _, _, substream in sheets:
+        offsets.append(position)
+        position += len(substream)
+    return globals_(offsets) + b''.join(substream for _, _, substream in sheets)
+
+
+def compound_file(stream):
+    """Wraps a Workbook stream in a compound file of 512-byte sectors, padded
+    past the 4096-byte mini stream cutoff."""
+    size = 512
+    stream += b'\x00' * (max(4096, -(-len(stream) // size) * size) - len(stream))
+    sectors = len(stream) // size
+    fat = [i + 1 for i in range(sectors - 1)] + [0xFFFFFFFE, 0xFFFFFFFE, 0xFFFFFFFD]
+    fat += [0xFFFFFFFF] * (128 - len(fat))
+    none = 0xFFFFFFFF
+
+    def entry(name, kind, child, start, length):
+        encoded = name.encode('utf-16-le') + b'\x00\x00'
+        return (encoded.ljust(64, b'\x00') + struct.pack('<HBBIII', len(encoded), kind, 1, none, none, child)
+                + b'\x00' * 36 + struct.pack('<IQ', start, length))
+
+    directory = entry('Root Entry', 5, 1, 0xFFFFFFFE, 0) + entry('Workbook', 2, none, 0, len(stream))
+    directory += (b'\x00' * 64 + struct.pack('<HBBIII', 0, 0, 0, none, none, none) + b'\x00' * 48) * 2
+    header = b'\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1' + b'\x00' * 16
+    header += struct.pack('<HHHHH', 0x3E, 3, 0xFFFE, 9, 6) + b'\x00' * 6
+    header += struct.pack('<IIIIIIIII', 0, 1, sectors, 0, 0x1000, 0xFFFFFFFE, 0, 0xFFFFFFFE, 0)
+    header += struct.pack('<I', sectors + 1) + struct.pack('<I', none) * 108
+    return header + stream + directory + struct.pack('<128I', *fat)
+
+
+def roster():
+    strings = ['ServiceName', 'Day', 'EventTime', 'EventID', 'AttendeeName', 'Birthdate', 'Start',
+               'Núñez, José', 'Monday', 'Splash ' + 'x' * 20 + 'é→end']
+    cells = sheet([
+        *[labelsst(0, column, column) for column in range(7)],
+        string_formula(1, 0, 'Splash 3', shared=True), labelsst(1, 1, 8), label(1, 2, '9:00 AM - 9:30 AM'),
+        mulrk(1, 3, [(0, rk_int(1203))]), labelsst(1, 4, 7), number(1, 5, 45000, 1), number(1, 6, 0.375, 3),
+        embedded_chart(),
+        labelsst(3, 0, 9), labelsst(3, 1, 8), string_formula(3, 2, '10:00 AM'), rk(3, 3, rk_int(12045) | 1),
+        label(3, 4, 'Amy Zed'), mulrk(3, 5, [(2, rk_int(45001)), (0, rk_int(7))]),
+    ])
+    notes = sheet([label(0, 0, 'notes')])
+    return workbook([('Notes', 0, notes), ('Chart1', 2, sheet([])), ('Roster', 0, cells)], strings=strings,
+                    active=2, formats=[(164, 'yyyy\\-mm\\-dd')], xfs=(0, 14, 164, 20))
+
+
+def wide():
+    cells = sheet([
+        label(0, 0, 'Name'), label(0, 300, 'past the last column'), number(0, 65535, 1),
+        mulrk(1, 253, [(0, rk_int(value)) for value in (1, 2, 3, 4, 5)]),
+        label(65535, 0, 'last row'),
+    ])
+    return workbook([('Sheet1', 0, cells)])
+
+
+for name, stream in (('roster.xls', roster()), ('wide.xls', wide())):
+    with open(name, 'wb') as out:
+        out.write(compound_file(stream))
@@ -0,0 +1,109 @@
+package tasks
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var clockPattern = regexp.MustCompile(`^(\d{1,2})(?:[:.h](\d{2}))?\s*([ap])?\.?\s*(m\.?)?$`)
+
+// parseClockTime parses a time of day such as "9:00 AM", "9am", "14:30" or
+// "14h30" into minutes after midnight.
+func parseClockTime(value string) (int, bool) {
+	clean := strings.ToLower(strings.TrimSpace(value))
+	match := clockPattern.FindStringSubmatch(clean)
+	if match == nil {
+		return 0, false
+	}
+
+	hours, _ := strconv.Atoi(match[1])
+	minutes := 0
+	if match[2] != "" {
+		minutes, _ = strconv.Atoi(match[2])
+	}
+	if minutes > 59 {
+		return 0, false
+	}
+
+	switch match[3] {
+	case "a":
+		if hours < 1 || hours > 12 {
+			return 0, false
+		}
+		if hours == 12 {
+			hours = 0
+		}
+	case "p":
+		if hours < 1 || hours > 12 {
+			return 0, false
+		}
+		if hours < 12 {
+			hours += 12
+		}
+	default:
+		if match[2] == "" || hours > 23 {
+			return 0, false
+		}
+	}
+	return hours*60 + minutes, true
+}
+
+// parseTimeRange parses "9:00 AM - 9:30 AM" style ranges. A meridiem on only
+// the end time ("9:00 - 9:30 AM") applies to both ends. A single time is
+// accepted with the end equal to the start.
+func parseTimeRange(value string) (int, int, bool) {
+	clean := strings.TrimSpace(value)
+	if clean == "" {
+		return 0, 0, false
+	}
+
+	parts := splitTimeRange(clean)
+	if len(parts) == 1 {
+		start, ok := parseClockTime(parts[0])
+		return start, start, ok
+	}
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	end, ok := parseClockTime(parts[1])
+	if !ok {
+		return 0, 0, false
+	}
+	startValue := parts[0]
+	if !hasMeridiem(startValue) && hasMeridiem(parts[1]) {
+		suffix := " am"
+		if end >= 12*60 {
+			suffix = " pm"
+		}
+		startValue += suffix
+	}
+	start, ok := parseClockTime(startValue)
+	if !ok {
+		return 0, 0, false
+	}
+	if start > end && !hasMeridiem(parts[0]) && start >= 12*60 {
+		// "11:30 - 12:15 PM" reads as a morning start.
+		start -= 12 * 60
+	}
+	return start, end, true
+}
+
+func hasMeridiem(value string) bool {
+	match := clockPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(value)))
+	return match != nil && match[3] != ""
+}
+
+func splitTimeRange(value string) []string {
+	lower := strings.ToLower(value)
+	for _, separator := range []string{" to ", "–", "—", "-"} {
+		if idx := strings.Index(lower, separator); idx >= 0 {
+			return []string{
+				strings.TrimSpace(value[:idx]),
+				strings.TrimSpace(value[idx+len(separator):]),
+			}
+		}
+	}
+	return []string{value}
+}
@@ -0,0 +1,349 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type WorkbookLayout string
+
+const (
+	LayoutSingleSheet WorkbookLayout = "single"
+	// LayoutMultiSheet writes a summary sheet followed by one sheet per day
+	// and one per instructor.
+	LayoutMultiSheet WorkbookLayout = "multi"
+	// LayoutByInstructor is a contact sheet for each instructor: their
+	// classes in time order with each student's phone number, on a sheet or
+	// printed page of its own.
+	LayoutByInstructor WorkbookLayout = "instructor"
+)
+
+const (
+	summarySheetName    = "Summary"
+	unassignedSheetName = "Unassigned"
+	noDaySheetName      = "No day"
+	maxSheetNameLength  = 31
+)
+
+// ParseWorkbookLayout accepts "single", "multi" and "instructor"; empty means
+// single.
+func ParseWorkbookLayout(value string) (WorkbookLayout, bool) {
+	switch layout := WorkbookLayout(strings.ToLower(strings.TrimSpace(value))); layout {
+	case "", LayoutSingleSheet:
+		return LayoutSingleSheet, true
+	case LayoutMultiSheet, LayoutByInstructor:
+		return layout, true
+	}
+	return LayoutSingleSheet, false
+}
+
+type sheetGroup struct {
+	name    string
+	day     bool
+	rosters []ClassRoster
+}
+
+// timeBlock counts the classes and students meeting on one day at one time.
+type timeBlock struct {
+	day      int
+	start    int
+	dayName  string
+	time     string
+	classes  int
+	students int
+}
+
+// writeMultiSheetWorkbook fills file with a summary sheet, a sheet per day and
+// a sheet per instructor.
+func writeMultiSheetWorkbook(file *excelize.File, classes []ClassRoster, options FormatOptions) error {
+	classes = append([]ClassRoster{}, classes...)
+	SortRosters(classes, options.SortOrder)
+	file.SetSheetName(file.GetSheetName(0), summarySheetName)
+	used := map[string]bool{strings.ToLower(summarySheetName): true}
+
+	groups := []*sheetGroup{}
+	dayGroups := map[string]*sheetGroup{}
+	for _, roster := range classes {
+		days := roster.MeetingDays()
+		if len(days) == 0 {
+			days = []string{""}
+		}
+		for _, day := range days {
+			group, ok := dayGroups[day]
+			if !ok {
+				group = &sheetGroup{day: true}
+				dayGroups[day] = group
+			}
+			group.rosters = append(group.rosters, roster)
+		}
+	}
+	for _, day := range append(append([]string{}, weekdayOrder...), "") {
+		group, ok := dayGroups[day]
+		if !ok {
+			continue
+		}
+		group.name = DayName(day)
+		if day == "" {
+			group.name = noDaySheetName
+		}
+		groups = append(groups, group)
+	}
+
+	groups = append(groups, instructorGroups(classes)...)
+
+	links := map[string]string{}
+	daySheets := map[string]string{}
+	for _, group := range groups {
+		list, err := BuildMasterList(group.rosters, options)
+		if errors.Is(err, ErrEmptyMasterList) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sheet := uniqueSheetName(group.name, used)
+		file.NewSheet(sheet)
+		blocks, err := writeMasterListSheet(file, sheet, list, options)
+		if err != nil {
+			return err
+		}
+
+		if group.day {
+			daySheets[group.name] = sheet
+			for code, row := range blocks {
+				if _, ok := links[code]; !ok {
+					links[code] = fmt.Sprintf("'%s'!A%d", strings.ReplaceAll(sheet, "'", "''"), row)
+				}
+			}
+		}
+	}
+
+	writeSummarySheet(file, classes, links, daySheets)
+	file.SetActiveSheet(0)
+	return nil
+}
+
+// instructorGroups groups classes by instructor, in name order, with classes
+// that have no instructor last under "Unassigned".
+func instructorGroups(classes []ClassRoster) []*sheetGroup {
+	groups := map[string]*sheetGroup{}
+	names := []string{}
+	for _, roster := range classes {
+		instructor := rosterInstructor(roster)
+		key := strings.ToLower(instructor)
+		group, ok := groups[key]
+		if !ok {
+			group = &sheetGroup{name: instructor}
+			groups[key] = group
+			if instructor != "" {
+				names = append(names, key)
+			}
+		}
+		group.rosters = append(group.rosters, roster)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return naturalCompare(names[i], names[j]) < 0
+	})
+
+	result := make([]*sheetGroup, 0, len(groups))
+	for _, key := range names {
+		result = append(result, groups[key])
+	}
+	if group, ok := groups[""]; ok {
+		group.name = unassignedSheetName
+		result = append(result, group)
+	}
+	return result
+}
+
+// writeInstructorSheets writes each section of an instructor-grouped
+// masterlist to a sheet of its own, named after the instructor.
+func writeInstructorSheets(file *excelize.File, sections []MasterListSection, options FormatOptions) error {
+	used := map[string]bool{}
+	first := file.GetSheetName(0)
+	for i, section := range sections {
+		sheet := uniqueSheetName(section.Title, used)
+		if i == 0 {
+			file.SetSheetName(first, sheet)
+		} else if _, err := file.NewSheet(sheet); err != nil {
+			return err
+		}
+		sheetOptions := options
+		sheetOptions.SessionName = sectionHeading(options.SessionName, section.Title)
+		if _, err := writeMasterListSheet(file, sheet, section.List, sheetOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rosterInstructor is the class's instructor, or failing that its first
+// student's.
+func rosterInstructor(roster ClassRoster) string {
+	instructor := strings.TrimSpace(roster.Instructor)
+	if instructor == "" && len(roster.Students) > 0 {
+		instructor = strings.TrimSpace(roster.Students[0].Instructor)
+	}
+	return instructor
+}
+
+func writeSummarySheet(file *excelize.File, classes []ClassRoster, links map[string]string, daySheets map[string]string) {
+	sheet := summarySheetName
+	boldStyle, _ := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	titleStyle, _ := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}})
+	linkStyle, _ := file.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "1265BE", Underline: "single"}})
+
+	row := 1
+	setRow := func(values ...interface{}) {
+		for col, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			file.SetCellValue(sheet, cell, value)
+		}
+		row++
+	}
+	heading := func(values ...interface{}) {
+		setRow(values...)
+		endCell, _ := excelize.CoordinatesToCellName(len(values), row-1)
+		file.SetCellStyle(sheet, fmt.Sprintf("A%d", row-1), endCell, boldStyle)
+	}
+	link := func(col int, target string) {
+		if target == "" {
+			return
+		}
+		cell, _ := excelize.CoordinatesToCellName(col, row-1)
+		file.SetCellHyperLink(sheet, cell, target, "Location")
+		file.SetCellStyle(sheet, cell, cell, linkStyle)
+	}
+
+	totalStudents := 0
+	for _, roster := range classes {
+		totalStudents += len(roster.Students)
+	}
+
+	setRow("Master list summary")
+	file.SetCellStyle(sheet, "A1", "A1", titleStyle)
+	setRow("Classes", len(classes))
+	setRow("Students", totalStudents)
+	row++
+
+	heading("Day", "Classes", "Students")
+	for _, day := range append(append([]string{}, weekdayOrder...), "") {
+		classCount, studentCount := 0, 0
+		for _, roster := range classes {
+			days := roster.MeetingDays()
+			if (day == "" && len(days) == 0) || (day != "" && sharesDay(days, []string{day})) {
+				classCount++
+				studentCount += len(roster.Students)
+			}
+		}
+		if classCount == 0 {
+			continue
+		}
+		name := DayName(day)
+		if day == "" {
+			name = noDaySheetName
+		}
+		setRow(name, classCount, studentCount)
+		if sheet, ok := daySheets[name]; ok {
+			link(1, fmt.Sprintf("'%s'!A1", strings.ReplaceAll(sheet, "'", "''")))
+		}
+	}
+	row++
+
+	heading("Code", "Level", "Day", "Time", "Instructor", "Enrolled", "Capacity", "Open")
+	for _, roster := range classes {
+		capacity := roster.EffectiveCapacity()
+		setRow(roster.Code, roster.ServiceName, roster.DayLabel, roster.Time, roster.Instructor, len(roster.Students), capacity, capacity-len(roster.Students))
+		link(1, links[roster.Code])
+	}
+	row++
+
+	heading("Day", "Time", "Classes", "Students")
+	for _, block := range timeBlocks(classes) {
+		setRow(block.dayName, block.time, block.classes, block.students)
+	}
+
+	autoSizeColumns(file, sheet, 8, row)
+}
+
+func timeBlocks(classes []ClassRoster) []timeBlock {
+	blocks := map[string]*timeBlock{}
+	order := []string{}
+	for _, roster := range classes {
+		days := roster.MeetingDays()
+		if len(days) == 0 {
+			days = []string{""}
+		}
+		timing := roster.ParsedSchedule()
+		start := -1
+		if timing.HasTime {
+			start = timing.StartMinutes
+		}
+		for _, day := range days {
+			key := day + "\x00" + strings.TrimSpace(roster.Time)
+			block, ok := blocks[key]
+			if !ok {
+				dayName := DayName(day)
+				if day == "" {
+					dayName = noDaySheetName
+				}
+				block = &timeBlock{
+					day:     firstWeekday([]string{day}),
+					start:   start,
+					dayName: dayName,
+					time:    strings.TrimSpace(roster.Time),
+				}
+				blocks[key] = block
+				order = append(order, key)
+			}
+			block.classes++
+			block.students += len(roster.Students)
+		}
+	}
+
+	result := make([]timeBlock, 0, len(order))
+	for _, key := range order {
+		result = append(result, *blocks[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if c := compareInts(result[i].day, result[j].day); c != 0 {
+			return c < 0
+		}
+		return compareStarts(result[i].start, result[j].start) < 0
+	})
+	return result
+}
+
+// uniqueSheetName makes name valid as an Excel sheet name and distinct from
+// the names already used.
+func uniqueSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	if runes := []rune(name); len(runes) > maxSheetNameLength {
+		name = string(runes[:maxSheetNameLength])
+	}
+
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		runes := []rune(name)
+		if len(runes)+len(suffix) > maxSheetNameLength {
+			runes = runes[:maxSheetNameLength-len(suffix)]
+		}
+		candidate = string(runes) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
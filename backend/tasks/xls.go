@@ -0,0 +1,554 @@
+package tasks
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// BIFF8 record types read from Excel 97-2003 workbooks.
+const (
+	xlsBOF        = 0x0809
+	xlsEOF        = 0x000A
+	xlsFilePass   = 0x002F
+	xlsDateMode   = 0x0022
+	xlsFormat     = 0x041E
+	xlsXF         = 0x00E0
+	xlsBoundSheet = 0x0085
+	xlsWindow1    = 0x003D
+	xlsSST        = 0x00FC
+	xlsContinue   = 0x003C
+	xlsLabelSST   = 0x00FD
+	xlsLabel      = 0x0204
+	xlsRString    = 0x00D6
+	xlsNumber     = 0x0203
+	xlsRK         = 0x027E
+	xlsMulRK      = 0x00BD
+	xlsFormula    = 0x0006
+	xlsString     = 0x0207
+	xlsBoolErr    = 0x0205
+)
+
+// xlsMaxColumn is the last column of a BIFF8 sheet; cells past it are
+// dropped rather than widening the row.
+const xlsMaxColumn = 255
+
+var errNotBIFF8 = errors.New("only Excel 97-2003 (BIFF8) .xls workbooks are supported; save the report as .xlsx or .csv")
+
+// XLSRows reads the rows of one worksheet of an Excel 97-2003 (.xls)
+// workbook. Such sheets hold at most 65,536 rows of 256 columns, so they are
+// read whole; each row keeps only its cells and is laid out when read.
+type XLSRows struct {
+	rows [][]xlsCell
+	row  int
+}
+
+type xlsCell struct {
+	column int
+	value  string
+}
+
+type xlsRecord struct {
+	kind uint16
+	data []byte
+}
+
+type xlsSheet struct {
+	name   string
+	offset int
+}
+
+// xlsWorkbook holds the workbook globals needed to read a sheet's cells.
+type xlsWorkbook struct {
+	stream   []byte
+	sheets   []xlsSheet
+	active   int
+	strings  []string
+	formats  map[uint16]string
+	xfs      []uint16
+	date1904 bool
+}
+
+// OpenXLSRows opens a .xls workbook and returns a reader over the selected
+// sheet, or the active sheet when none is requested. Sheets are chosen as for
+// OpenSpreadsheetRows. Numbers print without trailing zeros and dates as
+// "1/2/2006".
+func OpenXLSRows(reader io.ReaderAt, sheetName string) (*XLSRows, error) {
+	stream, err := xlsWorkbookStream(reader)
+	if err != nil {
+		return nil, fmt.Errorf("open workbook: %w", err)
+	}
+	book, err := readXLSGlobals(stream)
+	if err != nil {
+		return nil, fmt.Errorf("open workbook: %w", err)
+	}
+	sheet, err := book.selectSheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := book.readSheet(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("read sheet %q: %w", sheet.name, err)
+	}
+	return &XLSRows{rows: rows}, nil
+}
+
+func (x *XLSRows) Read() ([]string, error) {
+	if x.row >= len(x.rows) {
+		return nil, io.EOF
+	}
+	cells := x.rows[x.row]
+	x.row++
+	width := 0
+	for _, cell := range cells {
+		width = max(width, cell.column+1)
+	}
+	row := make([]string, width)
+	for _, cell := range cells {
+		row[cell.column] = cell.value
+	}
+	return row, nil
+}
+
+func (x *XLSRows) RowNumber() int {
+	return x.row
+}
+
+// xlsWorkbookStream reads the Workbook stream out of the compound file.
+// Excel 5 and 95 files name the stream Book instead.
+func xlsWorkbookStream(reader io.ReaderAt) ([]byte, error) {
+	doc, err := mscfb.New(reader)
+	if err != nil {
+		return nil, err
+	}
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		switch entry.Name {
+		case "Workbook":
+			return io.ReadAll(entry)
+		case "Book":
+			return nil, errNotBIFF8
+		}
+	}
+	return nil, errors.New("no Workbook stream; the file is not an Excel workbook")
+}
+
+// xlsRecords splits a substream into records, starting at offset and
+// stopping after its EOF record. Substreams nested in it, such as the chart
+// embedded in a worksheet, are skipped whole.
+func xlsRecords(stream []byte, offset int) ([]xlsRecord, error) {
+	records := []xlsRecord{}
+	depth := 0
+	for offset+4 <= len(stream) {
+		kind := binary.LittleEndian.Uint16(stream[offset:])
+		length := int(binary.LittleEndian.Uint16(stream[offset+2:]))
+		if offset+4+length > len(stream) {
+			return nil, errors.New("truncated record")
+		}
+		data := stream[offset+4 : offset+4+length]
+		offset += 4 + length
+		switch kind {
+		case xlsBOF:
+			depth++
+		case xlsEOF:
+			depth--
+		}
+		if depth > 1 || depth == 1 && kind == xlsEOF {
+			continue
+		}
+		records = append(records, xlsRecord{kind: kind, data: data})
+		if depth <= 0 {
+			return records, nil
+		}
+	}
+	return nil, errors.New("missing EOF record")
+}
+
+func readXLSGlobals(stream []byte) (*xlsWorkbook, error) {
+	records, err := xlsRecords(stream, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].kind != xlsBOF || len(records[0].data) < 2 ||
+		binary.LittleEndian.Uint16(records[0].data) != 0x0600 {
+		return nil, errNotBIFF8
+	}
+
+	book := &xlsWorkbook{stream: stream, formats: map[uint16]string{}}
+	for i, record := range records {
+		data := record.data
+		switch record.kind {
+		case xlsFilePass:
+			return nil, errors.New("workbook is password protected")
+		case xlsDateMode:
+			book.date1904 = len(data) >= 2 && binary.LittleEndian.Uint16(data) == 1
+		case xlsFormat:
+			if len(data) > 2 {
+				text, _ := readXLSString(&xlsStringReader{segments: [][]byte{data[2:]}}, 2)
+				book.formats[binary.LittleEndian.Uint16(data)] = text
+			}
+		case xlsXF:
+			if len(data) >= 4 {
+				book.xfs = append(book.xfs, binary.LittleEndian.Uint16(data[2:]))
+			}
+		case xlsWindow1:
+			if len(data) >= 12 {
+				book.active = int(binary.LittleEndian.Uint16(data[10:]))
+			}
+		case xlsBoundSheet:
+			if len(data) < 8 {
+				continue
+			}
+			if data[5] != 0 {
+				// Chart, macro and VB module sheets hold no rows.
+				if book.active > len(book.sheets) {
+					book.active--
+				}
+				continue
+			}
+			name, _ := readXLSString(&xlsStringReader{segments: [][]byte{data[6:]}}, 1)
+			book.sheets = append(book.sheets, xlsSheet{name: name, offset: int(binary.LittleEndian.Uint32(data))})
+		case xlsSST:
+			segments := [][]byte{}
+			if len(data) >= 8 {
+				segments = append(segments, data[8:])
+			}
+			for _, next := range records[i+1:] {
+				if next.kind != xlsContinue {
+					break
+				}
+				segments = append(segments, next.data)
+			}
+			book.strings = readXLSSharedStrings(segments, len(data) >= 8)
+		}
+	}
+	return book, nil
+}
+
+func (b *xlsWorkbook) selectSheet(requested string) (xlsSheet, error) {
+	if len(b.sheets) == 0 {
+		return xlsSheet{}, fmt.Errorf("workbook has no sheets")
+	}
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		if b.active >= 0 && b.active < len(b.sheets) {
+			return b.sheets[b.active], nil
+		}
+		return b.sheets[0], nil
+	}
+
+	names := make([]string, len(b.sheets))
+	for i, sheet := range b.sheets {
+		if strings.EqualFold(sheet.name, requested) {
+			return sheet, nil
+		}
+		names[i] = sheet.name
+	}
+	if index, err := strconv.Atoi(requested); err == nil && index >= 1 && index <= len(b.sheets) {
+		return b.sheets[index-1], nil
+	}
+	return xlsSheet{}, fmt.Errorf("sheet %q not found; available sheets: %s", requested, strings.Join(names, ", "))
+}
+
+// readSheet gathers a sheet's cells by row. Missing rows are empty.
+func (b *xlsWorkbook) readSheet(sheet xlsSheet) ([][]xlsCell, error) {
+	records, err := xlsRecords(b.stream, sheet.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]xlsCell{}
+	set := func(row uint16, column uint16, value string) {
+		if value == "" || column > xlsMaxColumn {
+			return
+		}
+		for len(rows) <= int(row) {
+			rows = append(rows, nil)
+		}
+		rows[row] = append(rows[row], xlsCell{column: int(column), value: value})
+	}
+	// A formula with a text result is followed by a STRING record holding
+	// it, possibly after the shared or array formula it uses.
+	var pendingRow, pendingColumn uint16
+	pending := false
+
+	for i, record := range records {
+		data := record.data
+		if record.kind == xlsString && pending {
+			segments := [][]byte{data}
+			for _, next := range records[i+1:] {
+				if next.kind != xlsContinue {
+					break
+				}
+				segments = append(segments, next.data)
+			}
+			text, _ := readXLSString(&xlsStringReader{segments: segments}, 2)
+			set(pendingRow, pendingColumn, text)
+			pending = false
+			continue
+		}
+		if len(data) < 6 {
+			continue
+		}
+		row := binary.LittleEndian.Uint16(data)
+		column := binary.LittleEndian.Uint16(data[2:])
+		xf := binary.LittleEndian.Uint16(data[4:])
+		switch record.kind {
+		case xlsLabelSST:
+			if len(data) >= 10 {
+				if index := int(binary.LittleEndian.Uint32(data[6:])); index < len(b.strings) {
+					set(row, column, b.strings[index])
+				}
+			}
+		case xlsLabel, xlsRString:
+			text, _ := readXLSString(&xlsStringReader{segments: [][]byte{data[6:]}}, 2)
+			set(row, column, text)
+		case xlsNumber:
+			if len(data) >= 14 {
+				set(row, column, b.formatNumber(math.Float64frombits(binary.LittleEndian.Uint64(data[6:])), xf))
+			}
+		case xlsRK:
+			if len(data) >= 10 {
+				set(row, column, b.formatNumber(xlsRKValue(binary.LittleEndian.Uint32(data[6:])), xf))
+			}
+		case xlsMulRK:
+			for offset := 4; offset+6 <= len(data)-2 && column <= xlsMaxColumn; offset += 6 {
+				xf := binary.LittleEndian.Uint16(data[offset:])
+				set(row, column, b.formatNumber(xlsRKValue(binary.LittleEndian.Uint32(data[offset+2:])), xf))
+				column++
+			}
+		case xlsFormula:
+			if len(data) < 14 {
+				continue
+			}
+			result := data[6:14]
+			if result[6] != 0xFF || result[7] != 0xFF {
+				set(row, column, b.formatNumber(math.Float64frombits(binary.LittleEndian.Uint64(result)), xf))
+				continue
+			}
+			switch result[0] {
+			case 0:
+				pendingRow, pendingColumn, pending = row, column, true
+			case 1:
+				set(row, column, xlsBool(result[2]))
+			}
+		case xlsBoolErr:
+			if len(data) >= 8 && data[7] == 0 {
+				set(row, column, xlsBool(data[6]))
+			}
+		}
+	}
+	return rows, nil
+}
+
+func xlsBool(value byte) string {
+	if value != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// xlsRKValue decodes the compressed RK number format.
+func xlsRKValue(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+// formatNumber writes dates and times in the US style the exports use, and
+// other numbers as plain decimals, so codes and phone numbers read as typed.
+func (b *xlsWorkbook) formatNumber(value float64, xf uint16) string {
+	if int(xf) < len(b.xfs) {
+		if hasDate, hasTime := xlsDateFormat(b.xfs[xf], b.formats); hasDate || hasTime {
+			epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+			if b.date1904 {
+				epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+			}
+			moment := epoch.Add(time.Duration(math.Round(value*86400)) * time.Second)
+			switch {
+			case hasDate && hasTime:
+				return moment.Format("1/2/2006 3:04 PM")
+			case hasDate:
+				return moment.Format("1/2/2006")
+			default:
+				return moment.Format("3:04 PM")
+			}
+		}
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// xlsDateFormat reports whether a number format shows a date, a time or
+// both: the built-in date and time formats, or a custom format with day,
+// month, year, hour or second codes outside quotes and brackets.
+func xlsDateFormat(id uint16, formats map[uint16]string) (bool, bool) {
+	switch {
+	case id >= 14 && id <= 17, id >= 27 && id <= 31, id >= 34 && id <= 36, id >= 50 && id <= 58:
+		return true, false
+	case id == 22:
+		return true, true
+	case id >= 18 && id <= 21, id == 32, id == 33, id >= 45 && id <= 47:
+		return false, true
+	}
+	format, ok := formats[id]
+	if !ok {
+		return false, false
+	}
+
+	hasDate, hasTime := false, false
+	quoted, bracketed, escaped := false, false, false
+	for _, r := range strings.ToLower(format) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '[':
+			bracketed = true
+		case r == ']':
+			bracketed = false
+		case bracketed:
+		case r == ';':
+			return hasDate, hasTime
+		case r == 'd' || r == 'y':
+			hasDate = true
+		case r == 'h' || r == 's':
+			hasTime = true
+		}
+	}
+	return hasDate, hasTime
+}
+
+// xlsStringReader reads BIFF8 strings from a record and the CONTINUE records
+// after it. Character data carried into a CONTINUE record starts with a new
+// option byte saying whether the characters are one byte or two.
+type xlsStringReader struct {
+	segments [][]byte
+	segment  int
+	offset   int
+}
+
+func (r *xlsStringReader) next() bool {
+	for r.segment < len(r.segments) && r.offset >= len(r.segments[r.segment]) {
+		r.segment++
+		r.offset = 0
+	}
+	return r.segment < len(r.segments)
+}
+
+func (r *xlsStringReader) bytes(count int) ([]byte, bool) {
+	out := make([]byte, 0, count)
+	for len(out) < count {
+		if !r.next() {
+			return out, false
+		}
+		segment := r.segments[r.segment]
+		take := min(count-len(out), len(segment)-r.offset)
+		out = append(out, segment[r.offset:r.offset+take]...)
+		r.offset += take
+	}
+	return out, true
+}
+
+func (r *xlsStringReader) skip(count int) bool {
+	_, ok := r.bytes(count)
+	return ok
+}
+
+// readXLSString reads a string whose character count takes lengthBytes
+// bytes, followed by its option byte, run and phonetic sizes, characters,
+// and formatting runs and phonetic data, which are skipped.
+func readXLSString(r *xlsStringReader, lengthBytes int) (string, bool) {
+	header, ok := r.bytes(lengthBytes + 1)
+	if !ok {
+		return "", false
+	}
+	count := int(header[0])
+	if lengthBytes == 2 {
+		count = int(binary.LittleEndian.Uint16(header))
+	}
+	options := header[lengthBytes]
+	runs, phonetic := 0, 0
+	if options&0x08 != 0 {
+		value, ok := r.bytes(2)
+		if !ok {
+			return "", false
+		}
+		runs = int(binary.LittleEndian.Uint16(value))
+	}
+	if options&0x04 != 0 {
+		value, ok := r.bytes(4)
+		if !ok {
+			return "", false
+		}
+		phonetic = int(binary.LittleEndian.Uint32(value))
+	}
+
+	wide := options&0x01 != 0
+	units := make([]uint16, 0, count)
+	for len(units) < count {
+		if r.segment < len(r.segments) && r.offset >= len(r.segments[r.segment]) {
+			// The characters go on in the next CONTINUE record.
+			r.segment++
+			r.offset = 0
+			flag, ok := r.bytes(1)
+			if !ok {
+				return "", false
+			}
+			wide = flag[0]&0x01 != 0
+		}
+		if r.segment >= len(r.segments) {
+			return "", false
+		}
+		segment := r.segments[r.segment]
+		if wide {
+			if r.offset+2 > len(segment) {
+				return "", false
+			}
+			units = append(units, binary.LittleEndian.Uint16(segment[r.offset:]))
+			r.offset += 2
+		} else {
+			units = append(units, uint16(segment[r.offset]))
+			r.offset++
+		}
+	}
+	if !r.skip(runs*4 + phonetic) {
+		return string(utf16.Decode(units)), false
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// readXLSSharedStrings reads the shared string table of an SST record, whose
+// segments are the record after its counts and the CONTINUE records after it.
+func readXLSSharedStrings(segments [][]byte, ok bool) []string {
+	table := []string{}
+	if !ok {
+		return table
+	}
+	reader := &xlsStringReader{segments: segments}
+	for reader.next() {
+		text, ok := readXLSString(reader, 2)
+		table = append(table, text)
+		if !ok {
+			break
+		}
+	}
+	return table
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata are written by make_xls.py.
+func TestOpenXLSRows(t *testing.T) {
+	wideRow := make([]string, xlsMaxColumn+1)
+	wideRow[253], wideRow[254], wideRow[255] = "1", "2", "3"
+
+	tests := []struct {
+		name  string
+		file  string
+		sheet string
+		count int
+		// rows holds the expected rows by row number.
+		rows map[int][]string
+	}{
+		{
+			name:  "saved by Excel",
+			file:  "excel.xls",
+			count: 4,
+			rows: map[int][]string{
+				0: {"Test1", "Lorem", "Ipsum"},
+				1: {"Avocado", "1", "2"},
+				3: {"", "4", "7"},
+			},
+		},
+		{
+			name:  "active sheet past a chart sheet",
+			file:  "roster.xls",
+			count: 4,
+			rows: map[int][]string{
+				0: {"ServiceName", "Day", "EventTime", "EventID", "AttendeeName", "Birthdate", "Start"},
+				// A shared formula's text result, MULRK, a built-in date
+				// format and a time.
+				1: {"Splash 3", "Monday", "9:00 AM - 9:30 AM", "1203", "Núñez, José", "3/15/2023", "9:00 AM"},
+				2: {},
+				// After an embedded chart: a shared string split across
+				// CONTINUE, a formula string, an RK decimal and a custom date
+				// format in a MULRK.
+				3: {"Splash xxxxxxxxxxxxxxxxxxxxé→end", "Monday", "10:00 AM", "120.45", "Amy Zed", "3/16/2023", "7"},
+			},
+		},
+		{
+			name:  "sheet by number",
+			file:  "roster.xls",
+			sheet: "1",
+			count: 1,
+			rows:  map[int][]string{0: {"notes"}},
+		},
+		{
+			name:  "cells past the last column",
+			file:  "wide.xls",
+			count: 65536,
+			rows: map[int][]string{
+				0:     {"Name"},
+				1:     wideRow,
+				65535: {"last row"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			reader, err := OpenXLSRows(file, test.sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			for {
+				row, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, ok := test.rows[count]; ok && !reflect.DeepEqual(row, want) {
+					t.Errorf("row %d = %q, want %q", count+1, row, want)
+				}
+				count++
+			}
+			if count != test.count {
+				t.Errorf("read %d rows, want %d", count, test.count)
+			}
+		})
+	}
+}
+
+func TestOpenXLSRowsMissingSheet(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "roster.xls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = OpenXLSRows(file, "Chart1")
+	if err == nil || !strings.Contains(err.Error(), "available sheets: Notes, Roster") {
+		t.Fatalf("OpenXLSRows(Chart1) error = %v, want the worksheets listed", err)
+	}
+}
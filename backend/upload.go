@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cob-aquatics/tasks"
+)
+
+const (
+	defaultMaxUploadMB   = 32
+	defaultMaxUploadRows = 100000
+	// multipartMemoryBytes is the part of a form kept in memory; larger
+	// uploads spill to a temporary file, which the server removes after the
+	// request.
+	multipartMemoryBytes = 1 << 20
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	ole2Magic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+	maxUploadBytes = int64(envInt("MAX_UPLOAD_MB", defaultMaxUploadMB)) << 20
+	maxUploadRows  = envInt("MAX_UPLOAD_ROWS", defaultMaxUploadRows)
+)
+
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		http.Error(w, uploadErr.message, uploadErr.status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// parseUploadForm caps the request body at MAX_UPLOAD_MB and parses the
+// multipart form, so oversized uploads fail with 413 before any parsing.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(multipartMemoryBytes); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return &uploadError{
+				status:  http.StatusRequestEntityTooLarge,
+				message: fmt.Sprintf("Upload exceeds the %d MB limit", maxUploadBytes>>20),
+			}
+		}
+		return &uploadError{status: http.StatusBadRequest, message: "Unable to parse form"}
+	}
+	return nil
+}
+
+// openUploadRows streams the uploaded roster export in the given form field.
+// Excel workbooks are detected from their content, so a mislabelled extension
+// does not matter. Text exports have their encoding and delimiter detected.
+// The first row returned is the header row. The returned func releases the
+// upload and must be called once reading is done.
+func openUploadRows(r *http.Request, field string) (tasks.RowReader, func(), error) {
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, nil, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("No file uploaded in %s", field)}
+	}
+
+	headerRow := 0
+	if value := strings.TrimSpace(r.FormValue("header_row")); value != "" {
+		headerRow, err = strconv.Atoi(value)
+		if err != nil || headerRow < 1 {
+			file.Close()
+			return nil, nil, &uploadError{status: http.StatusBadRequest, message: "Invalid header_row"}
+		}
+	}
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(ole2Magic))
+
+	var rows tasks.RowReader
+	closeRows := func() { file.Close() }
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		sheetRows, err := tasks.OpenSpreadsheetRows(reader, r.FormValue("sheet"))
+		if err != nil {
+			file.Close()
+			return nil, nil, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Error reading spreadsheet: %v", err)}
+		}
+		rows = sheetRows
+		closeRows = func() {
+			sheetRows.Close()
+			file.Close()
+		}
+	case bytes.HasPrefix(magic, ole2Magic):
+		rows, err = tasks.OpenXLSRows(file, r.FormValue("sheet"))
+		if err != nil {
+			file.Close()
+			return nil, nil, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Error reading spreadsheet: %v", err)}
+		}
+	default:
+		rows, _, err = tasks.NewDelimitedRowReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, nil, &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Error reading CSV: %v", err)}
+		}
+	}
+
+	rows, err = tasks.SkipToHeaderRow(tasks.LimitRows(rows, maxUploadRows), headerRow)
+	if err != nil {
+		closeRows()
+		return nil, nil, classifyRowsError(err)
+	}
+	return rows, closeRows, nil
+}
+
+// readUploadRecords reads the whole csv_file upload, header row first.
+func readUploadRecords(r *http.Request) ([][]string, error) {
+	rows, closeRows, err := openUploadRows(r, "csv_file")
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows()
+
+	records, err := tasks.ReadAllRows(rows)
+	if err != nil {
+		return nil, classifyRowsError(err)
+	}
+	return records, nil
+}
+
+func processUploadField(r *http.Request, field string, profileName string, day string, instructors tasks.InstructorAssignment) (tasks.CSVResult, error) {
+	nameDisplay, err := formNameDisplay(r)
+	if err != nil {
+		return tasks.CSVResult{}, err
+	}
+	sessionStart, err := formSessionStart(r)
+	if err != nil {
+		return tasks.CSVResult{}, err
+	}
+
+	sortOrder, err := formSortOrder(r)
+	if err != nil {
+		return tasks.CSVResult{}, err
+	}
+
+	rows, closeRows, err := openUploadRows(r, field)
+	if err != nil {
+		return tasks.CSVResult{}, err
+	}
+	defer closeRows()
+
+	result, err := tasks.ProcessCSVRows(rows, tasks.CSVOptions{
+		ProfileName:  profileName,
+		FallbackDay:  day,
+		NameDisplay:  nameDisplay,
+		SessionStart: sessionStart,
+		SortOrder:    sortOrder,
+	}, instructors)
+	if err != nil {
+		return result, classifyRowsError(err)
+	}
+	return result, nil
+}
+
+func formNameDisplay(r *http.Request) (tasks.NameDisplay, error) {
+	display, ok := tasks.ParseNameDisplay(r.FormValue("name_display"))
+	if !ok {
+		return display, &uploadError{status: http.StatusBadRequest, message: "Invalid name_display; use first_last or last_first"}
+	}
+	return display, nil
+}
+
+func formSessionStart(r *http.Request) (time.Time, error) {
+	sessionStart, ok := tasks.ParseSessionStart(r.FormValue("session_start"))
+	if !ok {
+		return sessionStart, &uploadError{status: http.StatusBadRequest, message: "Invalid session_start date"}
+	}
+	return sessionStart, nil
+}
+
+func formSortOrder(r *http.Request) (tasks.SortOrder, error) {
+	order, ok := tasks.ParseSortOrder(r.FormValue("sort"))
+	if !ok {
+		return order, &uploadError{status: http.StatusBadRequest, message: "Invalid sort; use time, instructor, location, level or code"}
+	}
+	return order, nil
+}
+
+// formColumns reads the masterlist column choice from the "columns" field,
+// falling back to the saved preset named in "preset".
+func formColumns(r *http.Request) ([]tasks.ColumnSpec, error) {
+	columns, err := tasks.ParseColumnList(r.FormValue("columns"))
+	if err != nil {
+		return nil, &uploadError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	if len(columns) > 0 {
+		return columns, nil
+	}
+	return resolveColumnChoice(nil, r.FormValue("preset"))
+}
+
+func classifyRowsError(err error) error {
+	var parseErr *csv.ParseError
+	switch {
+	case errors.Is(err, tasks.ErrTooManyRows):
+		return &uploadError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("Upload exceeds the %d row limit", maxUploadRows),
+		}
+	case errors.Is(err, tasks.ErrUnknownProfile):
+		return &uploadError{status: http.StatusBadRequest, message: err.Error()}
+	case errors.As(err, &parseErr):
+		return &uploadError{status: http.StatusBadRequest, message: fmt.Sprintf("Error reading CSV: %v", err)}
+	}
+	return &uploadError{status: http.StatusUnprocessableEntity, message: err.Error()}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cob-aquatics/tasks"
+)
+
+const maxStoredUploads = 50
+
+var (
+	uploadIDPattern   = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}-[0-9a-f]{8}$`)
+	errUploadNotFound = errors.New("stored upload not found")
+	uploads           = newUploadStore(resolveUploadStoreDir())
+)
+
+type storedUpload struct {
+	ID        string              `json:"id"`
+	Day       string              `json:"day"`
+	Profile   string              `json:"profile"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Classes   []tasks.ClassRoster `json:"classes"`
+}
+
+// uploadStore keeps the rosters from recent uploads on disk so that a new
+// export can be compared with the previous one. Student ages, birthdates,
+// guardians and medical alerts are left out of the stored copy.
+type uploadStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newUploadStore(dir string) *uploadStore {
+	return &uploadStore{dir: dir}
+}
+
+func resolveUploadStoreDir() string {
+	if dir := strings.TrimSpace(os.Getenv("UPLOAD_STORE_DIR")); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "deck-supervisor-uploads")
+}
+
+func (s *uploadStore) save(upload storedUpload) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	upload.CreatedAt = time.Now()
+	upload.ID = fmt.Sprintf("%s-%s", upload.CreatedAt.Format("20060102-150405"), hex.EncodeToString(suffix))
+	upload.Classes = withoutStudentDetails(upload.Classes)
+
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, upload.ID+".json"), data, 0o600); err != nil {
+		return "", err
+	}
+
+	s.prune()
+	return upload.ID, nil
+}
+
+// withoutStudentDetails copies classes without the sensitive student details
+// a diff or masterlist import never needs.
+func withoutStudentDetails(classes []tasks.ClassRoster) []tasks.ClassRoster {
+	stripped := make([]tasks.ClassRoster, len(classes))
+	for i, class := range classes {
+		class.Students = append([]tasks.RosterStudent{}, class.Students...)
+		for j := range class.Students {
+			student := &class.Students[j]
+			student.Birthdate, student.Age, student.Guardian, student.MedicalAlerts = "", nil, "", nil
+		}
+		stripped[i] = class
+	}
+	return stripped
+}
+
+// load returns a stored upload by ID. The ID "latest" returns the most recent
+// upload, restricted to the given day when one is set.
+func (s *uploadStore) load(id string, day string) (storedUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id = strings.TrimSpace(id)
+	if id != "latest" {
+		if !uploadIDPattern.MatchString(id) {
+			return storedUpload{}, errUploadNotFound
+		}
+		return s.read(id)
+	}
+
+	ids := s.ids()
+	for i := len(ids) - 1; i >= 0; i-- {
+		upload, err := s.read(ids[i])
+		if err != nil {
+			continue
+		}
+		if day == "" || strings.EqualFold(upload.Day, day) {
+			return upload, nil
+		}
+	}
+	return storedUpload{}, errUploadNotFound
+}
+
+func (s *uploadStore) read(id string) (storedUpload, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return storedUpload{}, errUploadNotFound
+		}
+		return storedUpload{}, err
+	}
+	var upload storedUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return storedUpload{}, err
+	}
+	return upload, nil
+}
+
+func (s *uploadStore) ids() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if uploadIDPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *uploadStore) prune() {
+	ids := s.ids()
+	for len(ids) > maxStoredUploads {
+		os.Remove(filepath.Join(s.dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+}
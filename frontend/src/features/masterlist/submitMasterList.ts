@@ -86,6 +86,7 @@ export async function submitMasterList({
 
   const formData = new FormData()
   formData.append('csv_file', csvBlob, 'masterlist.csv')
+  formData.append('day', selectedDay)
   instructorAssignments.forEach(instructor => {
     formData.append('instructor_names[]', instructor.name)
     formData.append('instructor_codes[]', instructor.codes)
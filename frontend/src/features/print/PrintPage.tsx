@@ -9,7 +9,7 @@ import {
   prefetchInstructorPacket,
   upsertInstructorPdf,
 } from '../../lib/instructorPdfCache'
-import { buildRosterGroups, sanitizeLevel } from '../rosters/utils'
+import { buildRosterGroups } from '../rosters/utils'
 import { printOptions } from './constants'
 import type { PrintOptionKey } from './types'
 import { useSessionInstructors } from './hooks/useSessionInstructors'
@@ -191,7 +191,6 @@ function PrintPage() {
       session: sessionName,
       filename,
       rosters: rostersToPrint.map(roster => ({
-        template: sanitizeLevel(roster.level),
         roster: {
           code: roster.code,
           level: roster.level,
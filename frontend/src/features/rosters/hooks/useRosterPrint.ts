@@ -1,5 +1,4 @@
 import type { RosterGroup } from '../types'
-import { sanitizeLevel } from '../utils'
 
 const SESSIONS_STORAGE_KEY = 'decksupervisor.sessions'
 const CURRENT_SESSION_KEY = 'decksupervisor.currentSessionId'
@@ -54,7 +53,6 @@ function getCurrentSessionName() {
 
 export function useRosterPrint() {
     const handlePrintRoster = async (roster: RosterGroup) => {
-        const template = sanitizeLevel(roster.level)
         const sessionName = getCurrentSessionName() || 'Summer 2025'
 
         try {
@@ -64,7 +62,6 @@ export function useRosterPrint() {
                     'Content-Type': 'application/json',
                 },
                 body: JSON.stringify({
-                    template,
                     session: sessionName,
                     roster: {
                         code: roster.code,
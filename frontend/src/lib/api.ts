@@ -11,13 +11,15 @@ type ProcessCsvResponse = {
 function rosterToStudents(rosters: ClassRoster[]): Student[] {
   const students: Student[] = []
   rosters.forEach(roster => {
+    // A class meeting on several days, such as "Tu,Th", is listed under each.
+    const days = roster.days?.length ? roster.days : [roster.day]
     roster.students.forEach(student => {
       const id = `${roster.code}-${student.name}-${roster.time}-${roster.day}`.replace(/\s+/g, '-')
-      students.push({
+      days.forEach(day => students.push({
         id,
         service_name: roster.serviceName,
         code: roster.code,
-        day: roster.day,
+        day,
         time: roster.time,
         location: roster.location,
         schedule: roster.schedule,
@@ -25,7 +27,7 @@ function rosterToStudents(rosters: ClassRoster[]): Student[] {
         phone: student.phone,
         instructor: student.instructor || roster.instructor,
         level: student.level || roster.serviceName,
-      })
+      }))
     })
   })
   return students
@@ -1,5 +1,5 @@
 import { getStudentsForDay } from './storage'
-import { buildRosterGroups, sanitizeLevel } from '../features/rosters/utils'
+import { buildRosterGroups } from '../features/rosters/utils'
 
 const DB_NAME = 'decksupervisor-pdf-cache'
 const DB_VERSION = 1
@@ -215,7 +215,6 @@ export async function prefetchInstructorPacket(day: string): Promise<void> {
           session: sessionName,
           filename: name,
           rosters: rosters.map(roster => ({
-            template: sanitizeLevel(roster.level),
             roster: {
               code: roster.code,
               level: roster.level,
@@ -58,6 +58,7 @@ export type ClassRoster = {
   code: string
   serviceName: string
   day: string
+  days?: string[]
   time: string
   location: string
   schedule: string